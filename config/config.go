@@ -28,6 +28,8 @@ type ConfigFile struct {
 	App struct {
 		JSecret             string
 		TkTime              string
+		AccessTkMinutes     int
+		RefreshTkDays       int
 		SwaggerBasePath     string
 		TokenPrefBackoffice string
 		TokenPref3rdParty   string
@@ -36,6 +38,48 @@ type ConfigFile struct {
 		LogLevel            string
 		MaxLogFiles         int
 	}
+	Mail struct {
+		Driver        string
+		From          string
+		SMTPHost      string
+		SMTPPort      int
+		SMTPUser      string
+		SMTPPassword  string
+		LogFile       string
+		ResetTkMin    int
+		VerifyTkHours int
+	}
+	Throttle struct {
+		FreeAttempts    int
+		BaseDelaySec    int
+		MaxDelaySec     int
+		LockoutAttempts int
+		LockoutMinutes  int
+		WindowMinutes   int
+	}
+	Booking struct {
+		WaitlistConfirmMin int
+		SchedulerSec       int
+		DecisionHours      int // MinCapacity is checked this many hours before the start date
+		MaxSeats           int // seats a single group booking may take
+	}
+	Payment struct {
+		Provider            string // stripe or fake
+		StripeSecretKey     string
+		StripeWebhookSecret string
+		FakeWebhookSecret   string
+		FakeEnabled         bool  // the fake provider confirms payments nobody made, never enable it in production
+		FakeIDSeed          int64 // the fake provider numbers its IDs from here
+		PendingMinutes      int   // a pending booking is released if its payment does not succeed in time
+		Currency            string
+		CardFeePercent      int // added to card payments, in percent of the price
+		CardFeeFixed        int // added to card payments, in the smallest currency unit
+		TopupMin            int // bounds of a mobile wallet top-up, in the smallest currency unit
+		TopupMax            int
+	}
+	Ticket struct {
+		SigningKey string // HMAC key of the QR payloads, shared with the scanner devices
+	}
 	AdminUser struct {
 		Username string
 		Password string
@@ -75,6 +119,14 @@ func (c *ConfigFile) Load() error {
 	// Application configuration
 	c.App.JSecret = c.getEnv("JWT_Secret", "0")
 	c.App.TkTime = c.getEnv("ExpireTokenTime", "1")
+	c.App.AccessTkMinutes, err = strconv.Atoi(c.getEnv("AccessTokenTime", "15"))
+	if err != nil {
+		return fmt.Errorf("invalid access token time: %v", err)
+	}
+	c.App.RefreshTkDays, err = strconv.Atoi(c.getEnv("RefreshTokenTime", "30"))
+	if err != nil {
+		return fmt.Errorf("invalid refresh token time: %v", err)
+	}
 	c.App.TokenPrefBackoffice = c.getEnv("TokenPrefBackoffice", "false")
 	c.App.TokenPref3rdParty = c.getEnv("TokenPref3rdParty", "false")
 	c.App.LogToFile, err = strconv.ParseBool(c.getEnv("LogToFile", "false"))
@@ -90,6 +142,101 @@ func (c *ConfigFile) Load() error {
 	if err != nil {
 		return fmt.Errorf("invalid CARPARK ID : %v", err)
 	}
+	// Mail configuration
+	c.Mail.Driver = c.getEnv("MAIL_DRIVER", "log")
+	c.Mail.From = c.getEnv("MAIL_FROM", "no-reply@eventy.local")
+	c.Mail.SMTPHost = c.getEnv("SMTP_HOST", "127.0.0.1")
+	c.Mail.SMTPPort, err = strconv.Atoi(c.getEnv("SMTP_PORT", "587"))
+	if err != nil {
+		return fmt.Errorf("invalid smtp port: %v", err)
+	}
+	c.Mail.SMTPUser = c.getEnv("SMTP_USER", "")
+	c.Mail.SMTPPassword = c.getEnv("SMTP_PASSWORD", "")
+	c.Mail.LogFile = c.getEnv("MAIL_LOG_FILE", "./logs/mail.log")
+	c.Mail.ResetTkMin, err = strconv.Atoi(c.getEnv("ResetTokenTime", "60"))
+	if err != nil {
+		return fmt.Errorf("invalid reset token time: %v", err)
+	}
+	c.Mail.VerifyTkHours, err = strconv.Atoi(c.getEnv("VerifyTokenTime", "48"))
+	if err != nil {
+		return fmt.Errorf("invalid verify token time: %v", err)
+	}
+
+	// Login throttle configuration
+	throttleSettings := []struct {
+		key, def string
+		dest     *int
+	}{
+		{"LOGIN_FREE_ATTEMPTS", "3", &c.Throttle.FreeAttempts},
+		{"LOGIN_BACKOFF_BASE", "1", &c.Throttle.BaseDelaySec},
+		{"LOGIN_BACKOFF_MAX", "60", &c.Throttle.MaxDelaySec},
+		{"LOGIN_LOCKOUT_ATTEMPTS", "10", &c.Throttle.LockoutAttempts},
+		{"LOGIN_LOCKOUT_MINUTES", "15", &c.Throttle.LockoutMinutes},
+		{"LOGIN_ATTEMPT_WINDOW", "15", &c.Throttle.WindowMinutes},
+	}
+	for _, setting := range throttleSettings {
+		*setting.dest, err = strconv.Atoi(c.getEnv(setting.key, setting.def))
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %v", setting.key, err)
+		}
+	}
+
+	// Booking configuration
+	c.Booking.WaitlistConfirmMin, err = strconv.Atoi(c.getEnv("WAITLIST_CONFIRM_MINUTES", "1440"))
+	if err != nil {
+		return fmt.Errorf("invalid waitlist confirmation window: %v", err)
+	}
+	c.Booking.SchedulerSec, err = strconv.Atoi(c.getEnv("SCHEDULER_INTERVAL", "60"))
+	if err != nil {
+		return fmt.Errorf("invalid scheduler interval: %v", err)
+	}
+	c.Booking.DecisionHours, err = strconv.Atoi(c.getEnv("MIN_CAPACITY_DECISION_HOURS", "48"))
+	if err != nil {
+		return fmt.Errorf("invalid min capacity decision deadline: %v", err)
+	}
+	c.Booking.MaxSeats, err = strconv.Atoi(c.getEnv("MAX_SEATS_PER_BOOKING", "10"))
+	if err != nil {
+		return fmt.Errorf("invalid maximum seats per booking: %v", err)
+	}
+
+	// Payment configuration
+	c.Payment.Provider = strings.ToLower(c.getEnv("PAYMENT_PROVIDER", "stripe"))
+	c.Payment.StripeSecretKey = c.getEnv("STRIPE_SECRET_KEY", "")
+	c.Payment.StripeWebhookSecret = c.getEnv("STRIPE_WEBHOOK_SECRET", "")
+	c.Payment.FakeWebhookSecret = c.getEnv("FAKE_WEBHOOK_SECRET", "")
+	c.Payment.FakeEnabled, err = strconv.ParseBool(c.getEnv("PAYMENT_FAKE_ENABLED", "false"))
+	if err != nil {
+		return fmt.Errorf("invalid fake payment provider switch: %v", err)
+	}
+	c.Payment.FakeIDSeed, err = strconv.ParseInt(c.getEnv("PAYMENT_FAKE_ID_SEED", "0"), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid fake payment ID seed: %v", err)
+	}
+	c.Payment.PendingMinutes, err = strconv.Atoi(c.getEnv("PAYMENT_PENDING_MINUTES", "30"))
+	if err != nil {
+		return fmt.Errorf("invalid payment pending window: %v", err)
+	}
+	c.Payment.Currency = strings.ToLower(c.getEnv("PAYMENT_CURRENCY", "usd"))
+	c.Payment.CardFeePercent, err = strconv.Atoi(c.getEnv("CARD_FEE_PERCENT", "0"))
+	if err != nil {
+		return fmt.Errorf("invalid card fee percent: %v", err)
+	}
+	c.Payment.CardFeeFixed, err = strconv.Atoi(c.getEnv("CARD_FEE_FIXED", "0"))
+	if err != nil {
+		return fmt.Errorf("invalid card fixed fee: %v", err)
+	}
+	c.Payment.TopupMin, err = strconv.Atoi(c.getEnv("TOPUP_MIN_AMOUNT", "100"))
+	if err != nil {
+		return fmt.Errorf("invalid minimum top-up: %v", err)
+	}
+	c.Payment.TopupMax, err = strconv.Atoi(c.getEnv("TOPUP_MAX_AMOUNT", "100000"))
+	if err != nil {
+		return fmt.Errorf("invalid maximum top-up: %v", err)
+	}
+
+	// Ticket configuration
+	c.Ticket.SigningKey = c.getEnv("TICKET_SIGNING_KEY", "")
+
 	// Backoffice Admin user data
 	c.AdminUser.Username = c.getEnv("USERNAME", "admin")
 	c.AdminUser.Password = c.getEnv("PASSWORD", "admin")
@@ -0,0 +1,38 @@
+package functions
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// HashPassword hashes a plaintext password with bcrypt
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether password matches the bcrypt hash
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// IsPasswordHash reports whether the stored value is already a bcrypt hash
+func IsPasswordHash(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") || strings.HasPrefix(stored, "$2b$") || strings.HasPrefix(stored, "$2y$")
+}
+
+// VerifyStoredPassword checks password against a stored value which can still be a legacy plaintext password.
+// needsUpgrade is true when the match was against plaintext and the row must be rehashed.
+func VerifyStoredPassword(stored, password string) (match bool, needsUpgrade bool) {
+	if IsPasswordHash(stored) {
+		return CheckPassword(stored, password), false
+	}
+
+	match = stored != "" && subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+	return match, match
+}
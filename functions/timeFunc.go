@@ -1,6 +1,9 @@
 package functions
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 func GetFormatedLocalTime() string {
 	var currentTime = time.Now()
@@ -9,3 +12,14 @@ func GetFormatedLocalTime() string {
 	return FormattedTime
 
 }
+
+// ParseEventDate parses the date formats accepted for event start and end dates
+func ParseEventDate(value string) (time.Time, error) {
+	layouts := []string{"2006-01-02", "2006-01-02 15:04:05", "2006-01-02T15:04", time.RFC3339}
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid event date: %q", value)
+}
@@ -7,7 +7,10 @@ import (
 	_ "eventy/docs"
 	"eventy/functions"
 	"eventy/pkg/db"
-	"eventy/pkg/models"
+	"eventy/pkg/mailer"
+	"eventy/pkg/payment"
+	"eventy/pkg/scheduler"
+	"eventy/pkg/ticket"
 	"eventy/routes"
 	"fmt"
 
@@ -33,6 +36,11 @@ func main() {
 
 	log.Info().Msg("------------------------------ # STARTING APPLICATION # ------------------------------")
 
+	// Without the key no ticket QR code can be shown, scanned or exported to the scanners
+	if err := ticket.Init(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to setup ticket signing, set TICKET_SIGNING_KEY")
+	}
+
 	//docs.SwaggerInfo.BasePath = config.Configvar.App.SwaggerBasePath
 
 	log.Info().Msgf("Server running on %s:%d ", config.Configvar.Server.Host, config.Configvar.Server.Port)
@@ -55,19 +63,28 @@ func main() {
 		log.Info().Str("Database ", config.Configvar.Database.Name).Msg("Successfully Connected to the Database.")
 	}
 
-	models := []interface{}{
-		&models.User{},
-		&models.Event{},
-		&models.Category{},
-	}
-
-	if err := functions.CreateTables(ctx, db.Db_GlobalVar, models); err != nil {
+	if err := functions.CreateTables(ctx, db.Db_GlobalVar, db.Models()); err != nil {
 		log.Error().Err(err).Msg("Failed to create tables")
 	} else {
 		log.Info().Msg("Tables Created successfully.")
 
 	}
 
+	if err := db.Migrate(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to migrate database")
+	}
+
+	if err := mailer.Init(); err != nil {
+		log.Error().Err(err).Msg("Failed to setup mailer")
+	}
+
+	if err := payment.Init(); err != nil {
+		log.Error().Err(err).Msg("Failed to setup payment provider")
+	}
+
+	// Background jobs: pending payments, waitlist offers and MinCapacity decisions
+	scheduler.Start(ctx)
+
 	// Router Setup
 	r := routes.SetupRouter()
 
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// CurrentUserID returns the ID of the mobile user authenticated by TokenMiddleware3rdParty
+func CurrentUserID(c *gin.Context) (int, bool) {
+	value, exists := c.Get(CtxUserID)
+	if !exists {
+		return 0, false
+	}
+	id, ok := value.(int)
+	return id, ok && id != 0
+}
+
+// ResolveUserID returns the authenticated user ID, rejecting requests that name another user.
+// requested is the optional user_id sent by the client; an empty string means "myself".
+func ResolveUserID(c *gin.Context, requested string) (int, bool) {
+	id, ok := CurrentUserID(c)
+	if !ok {
+		log.Warn().Msg("No authenticated user in request context")
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "Unauthorized, you need to connect first !",
+			"code":    -3,
+		})
+		return 0, false
+	}
+
+	if requested == "" || requested == "0" {
+		return id, true
+	}
+
+	requestedID, err := strconv.Atoi(requested)
+	if err != nil {
+		log.Warn().Err(err).Str("UserID", requested).Msg("Invalid User ID")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid User ID",
+			"code":    -400,
+		})
+		return 0, false
+	}
+
+	if requestedID != id {
+		log.Warn().Int("UserID", id).Int("RequestedUserID", requestedID).Msg("Cross-user access attempt")
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "You are not allowed to access another user's data",
+			"code":    -403,
+		})
+		return 0, false
+	}
+
+	return id, true
+}
+
+// Actor describes who performs the request, for audit records
+func Actor(c *gin.Context) string {
+	claims, ok := CurrentClaims(c)
+	if !ok {
+		return "system"
+	}
+	if claims.Role == RoleMobileUser {
+		return "user:" + strconv.Itoa(claims.UserID)
+	}
+	return "operator:" + claims.Username
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"eventy/config"
+	"eventy/pkg/db"
+	"eventy/pkg/models"
+	"sync"
+	"time"
+)
+
+// operatorCacheTTL bounds how long a change made by another instance takes to revoke a token,
+// changes made through this instance are seen right away
+const operatorCacheTTL = 30 * time.Second
+
+type cachedOperator struct {
+	operator *models.Operator
+	loadedAt time.Time
+}
+
+var (
+	operatorCacheMu sync.Mutex
+	operatorCache   = make(map[int]cachedOperator)
+)
+
+// currentOperator returns the stored operator behind a back-office token, from the cache when fresh
+func currentOperator(ctx context.Context, id int) (*models.Operator, error) {
+	operatorCacheMu.Lock()
+	cached, ok := operatorCache[id]
+	operatorCacheMu.Unlock()
+	if ok && time.Since(cached.loadedAt) < operatorCacheTTL {
+		return cached.operator, nil
+	}
+
+	operator, err := db.GetOperatorByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	operatorCacheMu.Lock()
+	operatorCache[id] = cachedOperator{operator: operator, loadedAt: time.Now()}
+	operatorCacheMu.Unlock()
+	return operator, nil
+}
+
+// ForgetOperator drops the cached operator, its next request reads the stored one
+func ForgetOperator(id int) {
+	operatorCacheMu.Lock()
+	delete(operatorCache, id)
+	operatorCacheMu.Unlock()
+}
+
+// isConfiguredAdminToken reports whether the claims belong to the admin user from the config,
+// the only operator without a database row
+func isConfiguredAdminToken(claims *ClaimsBackOffice) bool {
+	admin := config.Configvar.AdminUser.Username
+	return claims.OperatorID == 0 && admin != "" && claims.Username == admin && claims.Role == RoleSuperAdmin
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"eventy/config"
+	"eventy/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serveBackOffice sends a request with the token through TokenMiddlewareBackOffice and returns the status
+func serveBackOffice(t *testing.T, token string) int {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/backoffice/ping", TokenMiddlewareBackOffice(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodGet, "/backoffice/ping", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+// cacheOperator stores the operator as if just loaded, the middleware does not reach the database
+func cacheOperator(t *testing.T, operator models.Operator) {
+	t.Helper()
+	operatorCacheMu.Lock()
+	operatorCache[operator.OperatorID] = cachedOperator{operator: &operator, loadedAt: time.Now()}
+	operatorCacheMu.Unlock()
+	t.Cleanup(func() { ForgetOperator(operator.OperatorID) })
+}
+
+func TestBackOfficeTokenFollowsOperatorChanges(t *testing.T) {
+	saved := config.Configvar
+	t.Cleanup(func() { config.Configvar = saved })
+	config.Configvar.App.JSecret = "test-secret"
+	config.Configvar.App.TkTime = "1"
+	config.Configvar.AdminUser.Username = "admin"
+
+	operator := models.Operator{OperatorID: 7, Username: "alice", Role: RoleFinance, TokenVersion: 2}
+	token, _, err := GenerateToken(&operator)
+	if err != nil {
+		t.Fatalf("generating token: %v", err)
+	}
+
+	cacheOperator(t, operator)
+	if code := serveBackOffice(t, token); code != http.StatusOK {
+		t.Errorf("unchanged operator: status %d, want 200", code)
+	}
+
+	disabled := operator
+	disabled.IsDisabled = true
+	cacheOperator(t, disabled)
+	if code := serveBackOffice(t, token); code != http.StatusUnauthorized {
+		t.Errorf("disabled operator: status %d, want 401", code)
+	}
+
+	demoted := operator
+	demoted.Role = RoleDoorStaff
+	demoted.TokenVersion++
+	cacheOperator(t, demoted)
+	if code := serveBackOffice(t, token); code != http.StatusUnauthorized {
+		t.Errorf("demoted operator: status %d, want 401", code)
+	}
+
+	// The admin user from the config has no row to check
+	admin, _, err := GenerateToken(&models.Operator{Username: "admin", Role: RoleSuperAdmin})
+	if err != nil {
+		t.Fatalf("generating token: %v", err)
+	}
+	if code := serveBackOffice(t, admin); code != http.StatusOK {
+		t.Errorf("configured admin: status %d, want 200", code)
+	}
+
+	// A token without operator ID under another name is not the configured admin
+	forged, _, err := GenerateToken(&models.Operator{Username: "mallory", Role: RoleSuperAdmin})
+	if err != nil {
+		t.Fatalf("generating token: %v", err)
+	}
+	if code := serveBackOffice(t, forged); code != http.StatusUnauthorized {
+		t.Errorf("token without operator ID: status %d, want 401", code)
+	}
+}
@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// Back-office operator roles
+const (
+	RoleSuperAdmin     = "super_admin"
+	RoleEventManager   = "event_manager"
+	RoleGuestModerator = "guest_moderator"
+	RoleFinance        = "finance"
+	RoleDoorStaff      = "door_staff" // scanner devices at the event entrance
+)
+
+// BackofficeRoles lists every role that can be given to an operator
+var BackofficeRoles = []string{RoleSuperAdmin, RoleEventManager, RoleGuestModerator, RoleFinance, RoleDoorStaff}
+
+// backofficePermissions maps "METHOD route" to the roles allowed to call it.
+// The super-admin is allowed everywhere; routes missing from the matrix are super-admin only.
+var backofficePermissions = map[string][]string{
+	// Users
+	"GET /backoffice/get_users": {RoleGuestModerator, RoleFinance},
+
+	// Categories
+	"GET /backoffice/get_categories":                  {RoleEventManager},
+	"POST /backoffice/add_category":                   {RoleEventManager},
+	"PUT /backoffice/update_category/:category_id":    {RoleEventManager},
+	"DELETE /backoffice/delete_category/:category_id": {RoleEventManager},
+
+	// Events
+	"GET /backoffice/get_events":                {RoleEventManager, RoleFinance},
+	"GET /backoffice/get_events_at_risk":        {RoleEventManager},
+	"POST /backoffice/add_event":                {RoleEventManager},
+	"PUT /backoffice/update_event/:event_id":    {RoleEventManager},
+	"DELETE /backoffice/delete_event/:event_id": {RoleEventManager},
+
+	// Guests
+	"GET /backoffice/get_guests":              {RoleGuestModerator},
+	"POST /backoffice/accept_guest/:user_id":  {RoleGuestModerator},
+	"POST /backoffice/decline_guest/:user_id": {RoleGuestModerator},
+
+	// Bookings
+	"GET /backoffice/get_bookings":                {RoleEventManager, RoleFinance},
+	"POST /backoffice/cancel_booking/:booking_id": {RoleEventManager, RoleFinance},
+	"GET /backoffice/get_refunds":                 {RoleFinance},
+	"POST /backoffice/refund_booking/:booking_id": {RoleFinance},
+	"POST /backoffice/retry_refund/:refund_id":    {RoleFinance},
+	"GET /backoffice/get_waitlist":                {RoleEventManager},
+
+	// Ticket types
+	"GET /backoffice/get_ticket_types":                      {RoleEventManager, RoleFinance},
+	"POST /backoffice/add_ticket_type":                      {RoleEventManager},
+	"PUT /backoffice/update_ticket_type/:ticket_type_id":    {RoleEventManager},
+	"DELETE /backoffice/delete_ticket_type/:ticket_type_id": {RoleEventManager},
+
+	// Promo codes
+	"GET /backoffice/get_promo_codes":                {RoleEventManager, RoleFinance},
+	"POST /backoffice/add_promo_code":                {RoleEventManager},
+	"PUT /backoffice/update_promo_code/:promo_id":    {RoleEventManager},
+	"DELETE /backoffice/delete_promo_code/:promo_id": {RoleEventManager},
+
+	// Check-in
+	"POST /backoffice/check_in":             {RoleDoorStaff, RoleEventManager},
+	"GET /backoffice/get_check_in_stats":    {RoleDoorStaff, RoleEventManager},
+	"GET /backoffice/get_check_in_manifest": {RoleDoorStaff, RoleEventManager},
+	"POST /backoffice/sync_check_ins":       {RoleDoorStaff, RoleEventManager},
+
+	// Wallet
+	"PUT /backoffice/topup_balance/:user_id":  {RoleFinance},
+	"GET /backoffice/get_wallet_transactions": {RoleFinance},
+}
+
+// IsValidRole reports whether role is a known back-office role
+func IsValidRole(role string) bool {
+	for _, r := range BackofficeRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission reports whether role may call the given method and route
+func HasPermission(role, method, route string) bool {
+	if role == RoleSuperAdmin {
+		return true
+	}
+
+	for _, allowed := range backofficePermissions[method+" "+route] {
+		if allowed == role {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleMiddlewareBackOffice checks the operator role against the permission matrix.
+// It must run after TokenMiddlewareBackOffice.
+func RoleMiddlewareBackOffice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := CurrentClaims(c)
+		if !ok || !HasPermission(claims.Role, c.Request.Method, c.FullPath()) {
+			role := ""
+			if ok {
+				role = claims.Role
+			}
+			log.Warn().Str("Role", role).Str("Route", c.Request.Method+" "+c.FullPath()).Msg("Role not allowed on route")
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"message": "You are not allowed to perform this action",
+				"code":    -403,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// CurrentClaims returns the claims stored by the token middlewares
+func CurrentClaims(c *gin.Context) (*ClaimsBackOffice, bool) {
+	value, exists := c.Get(CtxClaims)
+	if !exists {
+		return nil, false
+	}
+	claims, ok := value.(*ClaimsBackOffice)
+	return claims, ok
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"eventy/config"
+	"time"
+)
+
+// RefreshTokenLifetime returns the validity of mobile refresh tokens (RefreshTokenTime, in days)
+func RefreshTokenLifetime() time.Duration {
+	days := config.Configvar.App.RefreshTkDays
+	if days <= 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// GenerateRefreshToken returns a random opaque refresh token and the hash to store server-side
+func GenerateRefreshToken() (string, string, error) {
+	token, err := RandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	return token, HashToken(token), nil
+}
+
+// RandomToken returns n random bytes encoded as URL-safe base64
+func RandomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashToken returns the SHA-256 hex digest of an opaque token, only digests are stored in the database
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,8 +1,12 @@
 package middleware
 
 import (
+	"database/sql"
+	"errors"
 	"eventy/config"
+	"eventy/pkg/models"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,33 +15,91 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-var JwtKey = []byte(config.Configvar.App.JSecret)
+// Role carried by tokens issued to mobile users
+const RoleMobileUser = "mobile_user"
+
+// Context keys set by the token middlewares
+const (
+	CtxClaims = "claims"
+	CtxUserID = "user_id"
+)
 
 // Claims struct to store JWT claims
 type ClaimsBackOffice struct {
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	Username     string `json:"username"`
+	Role         string `json:"role"`
+	UserID       int    `json:"user_id,omitempty"`
+	OperatorID   int    `json:"operator_id,omitempty"`
+	TokenVersion int    `json:"token_version,omitempty"` // operator token version the token was issued for
 	jwt.StandardClaims
 }
 
-func GenerateToken(username string, role string) (string, int, error) {
-	//var tk string = config.Configvar.App.TkTime
+// jwtKey is read lazily so the secret loaded from .env at startup is used
+func jwtKey() []byte {
+	return []byte(config.Configvar.App.JSecret)
+}
+
+// tokenLifetime returns the token validity configured through ExpireTokenTime (in hours)
+func tokenLifetime() time.Duration {
+	var tk string = config.Configvar.App.TkTime
 
 	// Convert string to int
-	//hours, _ := strconv.Atoi(tk)
-	expirationTime := time.Now().Add(time.Duration(1) * time.Hour)
+	hours, err := strconv.Atoi(tk)
+	if err != nil || hours <= 0 {
+		log.Warn().Str("ExpireTokenTime", tk).Msg("Invalid token lifetime, falling back to 1 hour")
+		hours = 1
+	}
+
+	return time.Duration(hours) * time.Hour
+}
+
+// GenerateToken issues a back-office token for the operator. The admin user from the config has no
+// operator ID, the token of any other operator is only valid while its token version is unchanged.
+func GenerateToken(operator *models.Operator) (string, int, error) {
+	expirationTime := time.Now().Add(tokenLifetime())
+
+	claims := &ClaimsBackOffice{
+		Username:     operator.Username,
+		Role:         operator.Role,
+		OperatorID:   operator.OperatorID,
+		TokenVersion: operator.TokenVersion,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: expirationTime.Unix(),
+		},
+	}
+
+	return signToken(claims)
+}
+
+// AccessTokenLifetime returns the short validity of mobile access tokens (AccessTokenTime, in minutes)
+func AccessTokenLifetime() time.Duration {
+	minutes := config.Configvar.App.AccessTkMinutes
+	if minutes <= 0 {
+		minutes = 15
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// GenerateUserToken issues a short-lived access token for a mobile user
+func GenerateUserToken(userID int, email string) (string, int, error) {
+	expirationTime := time.Now().Add(AccessTokenLifetime())
 
 	claims := &ClaimsBackOffice{
-		Username: username,
-		Role:     role,
+		Username: email,
+		Role:     RoleMobileUser,
+		UserID:   userID,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: expirationTime.Unix(),
 		},
 	}
 
+	return signToken(claims)
+}
+
+func signToken(claims *ClaimsBackOffice) (string, int, error) {
 	// Create the JWT token
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(JwtKey)
+	tokenString, err := token.SignedString(jwtKey())
 	if err != nil {
 		return "", 0, err
 	}
@@ -45,50 +107,141 @@ func GenerateToken(username string, role string) (string, int, error) {
 	return tokenString, 1, nil
 }
 
+// parseToken validates the bearer token of the request, aborting with 401 when it is missing or invalid
+func parseToken(c *gin.Context) (*ClaimsBackOffice, bool) {
+	tokenString := c.GetHeader("Authorization")
+	if tokenString == "" || !strings.HasPrefix(tokenString, "Bearer ") {
+		log.Warn().Msg("Authorization required ")
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    -3,
+			"error":   "Token is required",
+			"success": false,
+		})
+		c.Abort()
+		return nil, false
+	}
+	tokenString = strings.TrimPrefix(tokenString, "Bearer ")
+
+	claims := &ClaimsBackOffice{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return jwtKey(), nil
+	})
+
+	if err != nil || !token.Valid {
+		log.Warn().Str("Client ID", claims.Username).Msg("Unauthorized, you need to connect first!")
+
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"code":    -3,
+			"message": "Unauthorized, you need to connect first !",
+		})
+		c.Abort()
+		return nil, false
+	}
+
+	if claims.ExpiresAt < time.Now().Unix() {
+		log.Warn().Msg("Unauthorized, Token has expired!")
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"code":    -3,
+			"message": "Unauthorized, Token has expired!",
+		})
+		c.Abort()
+		return nil, false
+	}
+
+	return claims, true
+}
+
 // TokenMiddleware checks the token validity and expiration
 func TokenMiddlewareBackOffice() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		tokenString := c.GetHeader("Authorization")
-		if tokenString == "" || !strings.HasPrefix(tokenString, "Bearer ") {
-			log.Warn().Msg("Authorization required ")
+		claims, ok := parseToken(c)
+		if !ok {
+			return
+		}
+
+		// Mobile user tokens are not valid for the back-office
+		if claims.Role == RoleMobileUser || claims.Role == "" {
+			log.Warn().Str("Client ID", claims.Username).Str("Role", claims.Role).Msg("Token is not a back-office token")
 			c.JSON(http.StatusUnauthorized, gin.H{
-				"code":    -3,
-				"error":   "Token is required",
 				"success": false,
+				"code":    -3,
+				"message": "Unauthorized, you need to connect first !",
 			})
 			c.Abort()
 			return
 		}
-		tokenString = strings.TrimPrefix(tokenString, "Bearer ")
 
-		claims := &ClaimsBackOffice{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return JwtKey, nil
+		if !operatorStillValid(c, claims) {
+			return
+		}
+
+		c.Set(CtxClaims, claims)
+		c.Next()
+	}
+}
+
+// operatorStillValid checks the operator behind the token was not deleted, disabled or changed since it was issued,
+// aborting the request otherwise
+func operatorStillValid(c *gin.Context, claims *ClaimsBackOffice) bool {
+	if isConfiguredAdminToken(claims) {
+		return true
+	}
+
+	var operator *models.Operator
+	var err error
+	if claims.OperatorID != 0 {
+		operator, err = currentOperator(c.Request.Context(), claims.OperatorID)
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Err(err).Int("OperatorID", claims.OperatorID).Msg("Error loading operator")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"code":    -500,
+			"message": "Failed to check the operator",
 		})
+		c.Abort()
+		return false
+	}
 
-		if err != nil || !token.Valid {
-			log.Warn().Str("Client ID", claims.Username).Msg("Unauthorized, you need to connect first!")
+	if operator == nil || operator.IsDisabled || operator.TokenVersion != claims.TokenVersion || operator.Role != claims.Role {
+		log.Warn().Str("Client ID", claims.Username).Int("OperatorID", claims.OperatorID).Msg("Operator token revoked")
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"code":    -3,
+			"message": "Unauthorized, you need to connect first !",
+		})
+		c.Abort()
+		return false
+	}
+	return true
+}
 
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"success": false,
-				"code":    -3,
-				"message": "Unauthorized, you need to connect first !",
-			})
-			c.Abort()
+// TokenMiddleware3rdParty checks the mobile user token and stores the user identity in the context
+func TokenMiddleware3rdParty() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := parseToken(c)
+		if !ok {
 			return
 		}
 
-		if claims.ExpiresAt < time.Now().Unix() {
-			log.Warn().Msg("Unauthorized, Token has expired!")
+		if claims.Role != RoleMobileUser || claims.UserID == 0 {
+			log.Warn().Str("Client ID", claims.Username).Str("Role", claims.Role).Msg("Token is not a mobile user token")
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"success": false,
 				"code":    -3,
-				"message": "Unauthorized, Token has expired!",
+				"message": "Unauthorized, you need to connect first !",
 			})
 			c.Abort()
 			return
 		}
 
+		c.Set(CtxClaims, claims)
+		c.Set(CtxUserID, claims.UserID)
 		c.Next()
 	}
 }
@@ -0,0 +1,136 @@
+package backoffice
+
+import (
+	"context"
+	"crypto/subtle"
+	"eventy/config"
+	"eventy/functions"
+	"eventy/middleware"
+	"eventy/pkg/db"
+	"eventy/pkg/models"
+	"eventy/pkg/throttle"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// Login godoc
+//
+//	@Summary		Back-office login
+//	@Description	Authenticate a back-office operator and return a bearer token
+//	@Tags			Backoffice - Auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			credentials	body	models.BackofficeLogin	true	"Operator credentials"
+//	@Router			/login [post]
+func Login(c *gin.Context) {
+	ctx := context.Background()
+	var credentials models.BackofficeLogin
+
+	if err := c.ShouldBindJSON(&credentials); err != nil {
+		log.Warn().Err(err).Msg("Invalid request payload")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request payload",
+			"code":    -400,
+		})
+		return
+	}
+
+	// Refuse attempts while the operator or the client IP is throttled
+	throttler := throttle.Login()
+	accountKey := throttle.AccountKey("backoffice", credentials.Username)
+	ipKey := throttle.IPKey("backoffice", c.ClientIP())
+	if allowed, wait := throttler.Allow(accountKey, ipKey); !allowed {
+		retryAfter := int(math.Ceil(wait.Seconds()))
+		log.Warn().Str("Username", credentials.Username).Str("IP", c.ClientIP()).Dur("RetryAfter", wait).Msg("Back-office login throttled")
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"success":     false,
+			"message":     "Too many failed login attempts, try again later",
+			"retry_after": retryAfter,
+			"code":        -429,
+		})
+		return
+	}
+
+	operator, code := authenticateOperator(ctx, credentials.Username, credentials.Password)
+	if code == -1 {
+		throttler.Failure(accountKey, ipKey)
+	} else {
+		throttler.Success(accountKey)
+	}
+
+	switch code {
+	case -1:
+		log.Warn().Str("Username", credentials.Username).Msg("Invalid back-office credentials")
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "Invalid credentials",
+			"code":    -1,
+		})
+		return
+	case -2:
+		log.Warn().Str("Username", credentials.Username).Msg("Operator is disabled")
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "User is disabled",
+			"code":    -2,
+		})
+		return
+	}
+
+	token, _, err := middleware.GenerateToken(operator)
+	if err != nil {
+		log.Err(err).Str("Username", credentials.Username).Msg("Error generating token")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to generate token",
+			"code":    -500,
+		})
+		return
+	}
+
+	log.Info().Str("Username", credentials.Username).Msg("Back-office login successful")
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"message":  "Login successful",
+		"username": credentials.Username,
+		"role":     operator.Role,
+		"token":    "Bearer " + token,
+	})
+}
+
+// authenticateOperator returns the operator, or -1 for bad credentials and -2 for a disabled account.
+// The admin user from the config is always a super-admin, other operators are read from the database.
+func authenticateOperator(ctx context.Context, username, password string) (*models.Operator, int) {
+	if isConfiguredAdmin(username, password) {
+		return &models.Operator{Username: username, Role: middleware.RoleSuperAdmin}, 200
+	}
+
+	operator, err := db.GetOperatorByUsername(ctx, username)
+	if err != nil || !functions.CheckPassword(operator.Password, password) {
+		return nil, -1
+	}
+
+	if operator.IsDisabled {
+		return nil, -2
+	}
+
+	return operator, 200
+}
+
+// isConfiguredAdmin checks the credentials against the admin user loaded from the config
+func isConfiguredAdmin(username, password string) bool {
+	admin := config.Configvar.AdminUser
+	if admin.Username == "" || admin.Password == "" {
+		return false
+	}
+
+	userOK := subtle.ConstantTimeCompare([]byte(username), []byte(admin.Username)) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(password), []byte(admin.Password)) == 1
+	return userOK && passOK
+}
@@ -0,0 +1,351 @@
+package backoffice
+
+import (
+	"context"
+	"errors"
+	"eventy/middleware"
+	"eventy/pkg/db"
+	"eventy/pkg/models"
+	"eventy/pkg/notify"
+	"eventy/pkg/payment"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// GetBookings godoc
+//
+//	@Summary		Get bookings
+//	@Description	Get the bookings of an event or of a user
+//	@Tags			Backoffice - Bookings
+//	@Produce		json
+//	@Security		BearerAuthBackOffice
+//	@Param			event_id	query	string	false	"Event ID"
+//	@Param			user_id		query	string	false	"User ID"
+//	@Success		200			{array}	models.Booking	"List of Bookings"
+//	@Router			/get_bookings [get]
+func GetBookings(c *gin.Context) {
+	ctx := context.Background()
+	eventID, _ := strconv.Atoi(c.Query("event_id"))
+	userID, _ := strconv.Atoi(c.Query("user_id"))
+
+	var bookings []models.Booking
+	var err error
+	switch {
+	case eventID != 0:
+		bookings, err = db.GetBookingsByEvent(ctx, eventID)
+	case userID != 0:
+		bookings, err = db.GetBookingsByUser(ctx, userID)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request. 'event_id' or 'user_id' parameter is required.",
+			"code":    -400,
+		})
+		return
+	}
+
+	if err != nil {
+		log.Err(err).Msg("Error getting bookings")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "An unexpected error occurred. Please try again later.",
+			"code":    -500,
+		})
+		return
+	}
+
+	if len(bookings) == 0 {
+		log.Debug().Int("Booking List", len(bookings)).Msg("No data found")
+		c.JSON(http.StatusOK, []models.Booking{})
+		return
+	}
+
+	c.JSON(http.StatusOK, bookings)
+}
+
+// CancelBooking godoc
+//
+//	@Summary		Cancel a booking
+//	@Description	Cancel any booking and refund it through its payment method per the event policy, or fully with full_refund
+//	@Tags			Backoffice - Bookings
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuthBackOffice
+//	@Param			booking_id	path	int							true	"Booking ID"
+//	@Param			request		body	models.CancelBookingRequest	false	"Cancellation details"
+//	@Router			/cancel_booking/{booking_id} [post]
+func CancelBooking(c *gin.Context) {
+	ctx := context.Background()
+	idStr := c.Param("booking_id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Warn().Err(err).Str("BookingID", idStr).Msg("Invalid Booking ID")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid Booking ID",
+			"code":    -400,
+		})
+		return
+	}
+
+	var req models.CancelBookingRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Warn().Err(err).Msg("Invalid request payload")
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid request payload",
+				"code":    -400,
+			})
+			return
+		}
+	}
+
+	result, err := db.CancelBooking(ctx, db.CancelBookingParams{
+		BookingID:  id,
+		Actor:      middleware.Actor(c),
+		Reason:     req.Reason,
+		FullRefund: req.FullRefund,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrBookingNotFound):
+			log.Warn().Int("BookingID", id).Msg("No booking found with the given ID")
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "No booking found with the given ID",
+				"code":    -404,
+			})
+		case errors.Is(err, db.ErrBookingNotActive):
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"message": "Booking is not active",
+				"code":    -409,
+			})
+		case errors.Is(err, db.ErrWalletCurrency):
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"message": "The refund cannot be credited to the wallet, the event is priced in another currency",
+				"code":    -409,
+			})
+		default:
+			log.Err(err).Int("BookingID", id).Msg("Error cancelling booking")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "Failed to cancel booking",
+				"code":    -500,
+			})
+		}
+		return
+	}
+
+	payment.ProcessRefunds(ctx, result.Refund)
+	notify.WaitlistPromotions(ctx, result.Promotions)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":        true,
+		"message":        "Booking cancelled successfully",
+		"booking_id":     result.Booking.BookingID,
+		"refund_amount":  result.Refund.Amount,
+		"refund_percent": result.Refund.Percent,
+		"refund_method":  result.Refund.Method,
+		"refund_status":  result.Refund.Status,
+		"code":           200,
+	})
+}
+
+// GetRefunds godoc
+//
+//	@Summary		Get refunds
+//	@Description	Get the refund audit trail, optionally filtered by booking or user
+//	@Tags			Backoffice - Bookings
+//	@Produce		json
+//	@Security		BearerAuthBackOffice
+//	@Param			booking_id	query	string	false	"Booking ID"
+//	@Param			user_id		query	string	false	"User ID"
+//	@Success		200			{array}	models.Refund	"List of Refunds"
+//	@Router			/get_refunds [get]
+func GetRefunds(c *gin.Context) {
+	ctx := context.Background()
+	bookingID, _ := strconv.Atoi(c.Query("booking_id"))
+	userID, _ := strconv.Atoi(c.Query("user_id"))
+
+	refunds, err := db.GetRefunds(ctx, bookingID, userID)
+	if err != nil {
+		log.Err(err).Msg("Error getting refunds")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "An unexpected error occurred. Please try again later.",
+			"code":    -500,
+		})
+		return
+	}
+
+	if len(refunds) == 0 {
+		log.Debug().Int("Refund List", len(refunds)).Msg("No data found")
+		c.JSON(http.StatusOK, []models.Refund{})
+		return
+	}
+
+	c.JSON(http.StatusOK, refunds)
+}
+
+// RefundBooking godoc
+//
+//	@Summary		Refund a booking
+//	@Description	Refund part of a booking without cancelling it, through the wallet or the card it was paid with
+//	@Tags			Backoffice - Bookings
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuthBackOffice
+//	@Param			booking_id	path		int							true	"Booking ID"
+//	@Param			request		body		models.RefundBookingRequest	true	"Refund details"
+//	@Success		200			{object}	models.Refund				"Refund"
+//	@Router			/refund_booking/{booking_id} [post]
+func RefundBooking(c *gin.Context) {
+	ctx := context.Background()
+	idStr := c.Param("booking_id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Warn().Err(err).Str("BookingID", idStr).Msg("Invalid Booking ID")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid Booking ID",
+			"code":    -400,
+		})
+		return
+	}
+
+	var req models.RefundBookingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Warn().Err(err).Msg("Invalid request payload")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request payload",
+			"code":    -400,
+		})
+		return
+	}
+
+	refund, err := db.RefundBooking(ctx, db.RefundBookingParams{
+		BookingID: id,
+		Amount:    req.Amount,
+		Reason:    req.Reason,
+		Actor:     middleware.Actor(c),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrBookingNotFound):
+			log.Warn().Int("BookingID", id).Msg("No booking found with the given ID")
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "No booking found with the given ID",
+				"code":    -404,
+			})
+		case errors.Is(err, db.ErrBookingNotActive):
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"message": "Booking is not paid yet",
+				"code":    -409,
+			})
+		case errors.Is(err, db.ErrRefundTooLarge):
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"message": "Amount exceeds what is left to refund on the booking",
+				"code":    -409,
+			})
+		case errors.Is(err, db.ErrWalletCurrency):
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"message": "The refund cannot be credited to the wallet, the event is priced in another currency",
+				"code":    -409,
+			})
+		default:
+			log.Err(err).Int("BookingID", id).Msg("Error refunding booking")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "Failed to refund booking",
+				"code":    -500,
+			})
+		}
+		return
+	}
+
+	payment.ProcessRefunds(ctx, refund)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Refund recorded successfully",
+		"refund":  refund,
+		"code":    200,
+	})
+}
+
+// RetryRefund godoc
+//
+//	@Summary		Retry a refund
+//	@Description	Send a failed card refund to the payment provider again
+//	@Tags			Backoffice - Bookings
+//	@Produce		json
+//	@Security		BearerAuthBackOffice
+//	@Param			refund_id	path		int				true	"Refund ID"
+//	@Success		200			{object}	models.Refund	"Refund"
+//	@Router			/retry_refund/{refund_id} [post]
+func RetryRefund(c *gin.Context) {
+	ctx := context.Background()
+	idStr := c.Param("refund_id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Warn().Err(err).Str("RefundID", idStr).Msg("Invalid Refund ID")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid Refund ID",
+			"code":    -400,
+		})
+		return
+	}
+
+	refund, err := db.RetryRefund(ctx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrRefundNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "No refund found with the given ID",
+				"code":    -404,
+			})
+		case errors.Is(err, db.ErrRefundNotRetryable):
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"message": "Only failed card refunds can be retried",
+				"code":    -409,
+			})
+		case errors.Is(err, db.ErrRefundTooLarge):
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"message": "The booking has been refunded since, nothing is left to retry this refund",
+				"code":    -409,
+			})
+		default:
+			log.Err(err).Int("RefundID", id).Msg("Error retrying refund")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "Failed to retry refund",
+				"code":    -500,
+			})
+		}
+		return
+	}
+
+	payment.ProcessRefunds(ctx, refund)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Refund sent to the payment provider",
+		"refund":  refund,
+		"code":    200,
+	})
+}
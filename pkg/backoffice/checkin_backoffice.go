@@ -0,0 +1,250 @@
+package backoffice
+
+import (
+	"context"
+	"errors"
+	"eventy/middleware"
+	"eventy/pkg/db"
+	"eventy/pkg/models"
+	"eventy/pkg/ticket"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// CheckInTicket godoc
+//
+//	@Summary		Check in a ticket
+//	@Description	Validate a scanned QR payload or ticket code against the event and record the entry, the staff member and the gate
+//	@Tags			Backoffice - Check-in
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuthBackOffice
+//	@Param			request	body	models.CheckInRequest	true	"Scanned ticket"
+//	@Router			/check_in [post]
+func CheckInTicket(c *gin.Context) {
+	ctx := context.Background()
+
+	var req models.CheckInRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Warn().Err(err).Msg("Invalid request payload")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request payload",
+			"code":    -400,
+		})
+		return
+	}
+
+	code := req.Code
+	if req.QRPayload != "" {
+		var eventID int
+		var err error
+		code, eventID, err = ticket.Verify(req.QRPayload)
+		if err != nil {
+			log.Warn().Err(err).Int("EventID", req.EventID).Msg("Invalid ticket payload scanned")
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid ticket",
+				"code":    -400,
+			})
+			return
+		}
+		if eventID != req.EventID {
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"message": "Ticket is for another event",
+				"code":    -409,
+			})
+			return
+		}
+	}
+	if strings.TrimSpace(code) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "'qr_payload' or 'code' is required",
+			"code":    -400,
+		})
+		return
+	}
+
+	checkIn, t, err := db.CheckIn(ctx, db.CheckInParams{
+		EventID: req.EventID,
+		Code:    code,
+		Gate:    strings.TrimSpace(req.Gate),
+		Staff:   middleware.Actor(c),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrTicketNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "No ticket found with the given code",
+				"code":    -404,
+			})
+		case errors.Is(err, db.ErrAlreadyCheckedIn):
+			c.JSON(http.StatusConflict, gin.H{
+				"success":  false,
+				"message":  "Ticket already checked in",
+				"check_in": checkIn,
+				"code":     -409,
+			})
+		case errors.Is(err, db.ErrTicketWrongEvent):
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"message": "Ticket is for another event",
+				"code":    -409,
+			})
+		case errors.Is(err, db.ErrTicketVoid), errors.Is(err, db.ErrCheckInUnavailable):
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"message": err.Error(),
+				"code":    -409,
+			})
+		default:
+			log.Err(err).Int("EventID", req.EventID).Msg("Error checking in ticket")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "Failed to check in ticket",
+				"code":    -500,
+			})
+		}
+		return
+	}
+
+	log.Info().Msgf("Ticket %d checked in for event %d by %s at gate %q", t.TicketID, t.EventID, checkIn.Staff, checkIn.Gate)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"message":  "Ticket checked in successfully",
+		"check_in": checkIn,
+		"ticket":   t,
+		"code":     200,
+	})
+}
+
+// GetCheckInStats godoc
+//
+//	@Summary		Get check-in counts
+//	@Description	Get the live count of attendees checked in against the valid tickets of an event, per gate
+//	@Tags			Backoffice - Check-in
+//	@Produce		json
+//	@Security		BearerAuthBackOffice
+//	@Param			event_id	query		int					true	"Event ID"
+//	@Success		200			{object}	models.CheckInStats	"Check-in counts"
+//	@Router			/get_check_in_stats [get]
+func GetCheckInStats(c *gin.Context) {
+	ctx := context.Background()
+	eventID, err := strconv.Atoi(c.Query("event_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request. 'event_id' parameter is required.",
+			"code":    -400,
+		})
+		return
+	}
+
+	stats, err := db.GetCheckInStats(ctx, eventID)
+	if err != nil {
+		log.Err(err).Int("EventID", eventID).Msg("Error getting check-in stats")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "An unexpected error occurred. Please try again later.",
+			"code":    -500,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// GetCheckInManifest godoc
+//
+//	@Summary		Get the offline check-in manifest
+//	@Description	Get the signed list of valid ticket codes of an event, for scanners checking in without connectivity
+//	@Tags			Backoffice - Check-in
+//	@Produce		json
+//	@Security		BearerAuthBackOffice
+//	@Param			event_id	query		int						true	"Event ID"
+//	@Success		200			{object}	models.CheckInManifest	"Signed manifest"
+//	@Router			/get_check_in_manifest [get]
+func GetCheckInManifest(c *gin.Context) {
+	ctx := context.Background()
+	eventID, err := strconv.Atoi(c.Query("event_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request. 'event_id' parameter is required.",
+			"code":    -400,
+		})
+		return
+	}
+
+	manifest, err := db.GetCheckInManifest(ctx, eventID)
+	if err == nil {
+		err = ticket.SignManifest(manifest)
+	}
+	if err != nil {
+		log.Err(err).Int("EventID", eventID).Msg("Error building check-in manifest")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "An unexpected error occurred. Please try again later.",
+			"code":    -500,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, manifest)
+}
+
+// SyncCheckIns godoc
+//
+//	@Summary		Upload offline check-ins
+//	@Description	Record a batch of check-ins scanned offline, the earliest scan of a ticket is kept and the others are returned as conflicts
+//	@Tags			Backoffice - Check-in
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuthBackOffice
+//	@Param			request	body	models.SyncCheckInsRequest	true	"Offline check-ins"
+//	@Router			/sync_check_ins [post]
+func SyncCheckIns(c *gin.Context) {
+	ctx := context.Background()
+
+	var req models.SyncCheckInsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Warn().Err(err).Msg("Invalid request payload")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request payload",
+			"code":    -400,
+		})
+		return
+	}
+
+	accepted, conflicts, err := db.SyncCheckIns(ctx, req.EventID, req.DeviceID, middleware.Actor(c), req.CheckIns)
+	if err != nil {
+		log.Err(err).Int("EventID", req.EventID).Str("Device", req.DeviceID).Msg("Error syncing check-ins")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success":   false,
+			"message":   "Failed to sync check-ins",
+			"accepted":  accepted,
+			"conflicts": conflicts,
+			"code":      -500,
+		})
+		return
+	}
+
+	log.Info().Msgf("Device %s synced %d check-ins for event %d, %d conflicts", req.DeviceID, accepted, req.EventID, len(conflicts))
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"message":   "Check-ins synced successfully",
+		"accepted":  accepted,
+		"conflicts": conflicts,
+		"code":      200,
+	})
+}
@@ -2,8 +2,10 @@ package backoffice
 
 import (
 	"context"
+	"errors"
 	"eventy/pkg/db"
 	"eventy/pkg/models"
+	"eventy/pkg/notify"
 	"net/http"
 	"strconv"
 
@@ -59,6 +61,37 @@ func GetEvents(c *gin.Context) {
 	c.JSON(http.StatusOK, events)
 }
 
+// GetEventsAtRisk godoc
+//
+//	@Summary		Get events at risk
+//	@Description	Get the undecided events still below their minimum capacity, the closest decision deadline first
+//	@Tags			Backoffice - Events
+//	@Produce		json
+//	@Security		BearerAuthBackOffice
+//	@Success		200	{array}	models.EventAtRisk	"List of Events at risk"
+//	@Router			/get_events_at_risk [get]
+func GetEventsAtRisk(c *gin.Context) {
+	ctx := context.Background()
+
+	events, err := db.GetEventsAtRisk(ctx)
+	if err != nil {
+		log.Err(err).Msg("Error getting events at risk")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "An unexpected error occurred. Please try again later.",
+			"code":    -500,
+		})
+		return
+	}
+
+	if len(events) == 0 {
+		c.JSON(http.StatusOK, []models.EventAtRisk{})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
 // AddEvent godoc
 //
 //	@Summary		Add a new event
@@ -82,6 +115,10 @@ func AddEvent(c *gin.Context) {
 		return
 	}
 
+	// The status is decided by the MinCapacity check only
+	event.Status = ""
+	event.DecidedAt = nil
+
 	//	eventCap, _ := strconv.Atoi(event.Capacity)
 	err := db.AddEvent(ctx, &event)
 	if err != nil {
@@ -136,7 +173,18 @@ func UpdateEvent(c *gin.Context) {
 		return
 	}
 
+	updates.Status = ""
+	updates.DecidedAt = nil
+
 	rowsAffected, err := db.UpdateEvent(ctx, id, &updates)
+	if errors.Is(err, db.ErrTicketTypeQuota) {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "Capacity is below the sum of the ticket type quotas",
+			"code":    -409,
+		})
+		return
+	}
 	if err != nil {
 		log.Err(err).Msg("Error updating event")
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -157,10 +205,18 @@ func UpdateEvent(c *gin.Context) {
 		return
 	}
 
+	// A raised capacity frees seats for the waitlist
+	promotions, err := db.PromoteWaitlist(ctx, id)
+	if err != nil {
+		log.Err(err).Int("EventID", id).Msg("Error promoting waitlist")
+	}
+	notify.WaitlistPromotions(ctx, promotions)
+
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "Event updated successfully",
-		"code":    200,
+		"success":  true,
+		"message":  "Event updated successfully",
+		"promoted": len(promotions),
+		"code":     200,
 	})
 }
 
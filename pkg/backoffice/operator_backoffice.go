@@ -0,0 +1,310 @@
+package backoffice
+
+import (
+	"context"
+	"eventy/functions"
+	"eventy/middleware"
+	"eventy/pkg/db"
+	"eventy/pkg/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// GetOperators godoc
+//
+//	@Summary		Get all operators
+//	@Description	Get a list of all back-office operators
+//	@Tags			Backoffice - Operators
+//	@Produce		json
+//	@Security		BearerAuthBackOffice
+//	@Param			operator_id	query	string	false	"Operator ID"
+//	@Success		200			{array}	models.Operator	"List of Operators"
+//	@Router			/get_operators [get]
+func GetOperators(c *gin.Context) {
+	ctx := context.Background()
+	idStr := c.Query("operator_id")
+
+	id, _ := strconv.Atoi(idStr)
+
+	if idStr != "" {
+		log.Debug().Int("OperatorID", id).Msg("Get Operator by ID API request")
+		operator, err := db.GetOperatorByID(ctx, id)
+		if err != nil {
+			log.Warn().Err(err).Str("OperatorID", idStr).Msg("Error retrieving Operator ID")
+			c.JSON(http.StatusOK, []models.Operator{})
+			return
+		}
+
+		c.JSON(http.StatusOK, operator)
+		return
+	}
+
+	operators, err := db.GetAllOperators(ctx)
+	if err != nil {
+		log.Err(err).Msg("Error getting all operators")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "An unexpected error occurred. Please try again later.",
+			"code":    -500,
+		})
+		return
+	}
+
+	if len(operators) == 0 {
+		log.Debug().Int("Operator List", len(operators)).Msg("No data found")
+		c.JSON(http.StatusOK, []models.Operator{})
+		return
+	}
+
+	c.JSON(http.StatusOK, operators)
+}
+
+// AddOperator godoc
+//
+//	@Summary		Add a new operator
+//	@Description	Create a back-office operator account with a role
+//	@Tags			Backoffice - Operators
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuthBackOffice
+//	@Param			operator	body	models.OperatorRequest	true	"Operator data"
+//	@Router			/add_operator [post]
+func AddOperator(c *gin.Context) {
+	ctx := context.Background()
+	var req models.OperatorRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Warn().Err(err).Msg("Invalid request payload")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request payload",
+			"code":    -400,
+		})
+		return
+	}
+
+	if !middleware.IsValidRole(req.Role) {
+		log.Warn().Str("Role", req.Role).Msg("Invalid operator role")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid role",
+			"roles":   middleware.BackofficeRoles,
+			"code":    -400,
+		})
+		return
+	}
+
+	if _, err := db.GetOperatorByUsername(ctx, req.Username); err == nil {
+		log.Warn().Str("Username", req.Username).Msg("Operator already exists")
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "Operator already exists",
+			"code":    -409,
+		})
+		return
+	}
+
+	hash, err := functions.HashPassword(req.Password)
+	if err != nil {
+		log.Err(err).Msg("Error hashing operator password")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to add operator",
+			"code":    -500,
+		})
+		return
+	}
+
+	operator := models.Operator{
+		Username:   req.Username,
+		Password:   hash,
+		Role:       req.Role,
+		IsDisabled: req.IsDisabled,
+	}
+
+	if err := db.AddOperator(ctx, &operator); err != nil {
+		log.Err(err).Msg("Error adding operator")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to add operator",
+			"code":    -500,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"message":     "Operator added successfully",
+		"operator_id": operator.OperatorID,
+		"code":        200,
+	})
+}
+
+// UpdateOperator godoc
+//
+//	@Summary		Update an operator
+//	@Description	Update the username, password, role or status of an operator
+//	@Tags			Backoffice - Operators
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuthBackOffice
+//	@Param			operator_id	path	int								true	"Operator ID"
+//	@Param			operator	body	models.OperatorUpdateRequest	true	"Updated operator data"
+//	@Router			/update_operator/{operator_id} [put]
+func UpdateOperator(c *gin.Context) {
+	ctx := context.Background()
+	idStr := c.Param("operator_id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Warn().Err(err).Str("OperatorID", idStr).Msg("Invalid Operator ID")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid Operator ID",
+			"code":    -400,
+		})
+		return
+	}
+
+	var req models.OperatorUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Warn().Err(err).Msg("Invalid request payload")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request payload",
+			"code":    -400,
+		})
+		return
+	}
+
+	var updates models.Operator
+	var columns []string
+
+	if req.Username != "" {
+		updates.Username = req.Username
+		columns = append(columns, "username")
+	}
+	if req.Password != "" {
+		hash, err := functions.HashPassword(req.Password)
+		if err != nil {
+			log.Err(err).Msg("Error hashing operator password")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "Failed to update operator",
+				"code":    -500,
+			})
+			return
+		}
+		updates.Password = hash
+		columns = append(columns, "password")
+	}
+	if req.Role != "" {
+		if !middleware.IsValidRole(req.Role) {
+			log.Warn().Str("Role", req.Role).Msg("Invalid operator role")
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid role",
+				"roles":   middleware.BackofficeRoles,
+				"code":    -400,
+			})
+			return
+		}
+		updates.Role = req.Role
+		columns = append(columns, "role")
+	}
+	if req.IsDisabled != nil {
+		updates.IsDisabled = *req.IsDisabled
+		columns = append(columns, "is_disabled")
+	}
+
+	if len(columns) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Nothing to update",
+			"code":    -400,
+		})
+		return
+	}
+
+	rowsAffected, err := db.UpdateOperator(ctx, id, &updates, columns)
+	middleware.ForgetOperator(id)
+	if err != nil {
+		log.Err(err).Msg("Error updating operator")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to update operator",
+			"code":    -500,
+		})
+		return
+	}
+
+	if rowsAffected == 0 {
+		log.Warn().Int("OperatorID", id).Msg("No operator found with the given ID")
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "No operator found with the given ID",
+			"code":    -404,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Operator updated successfully",
+		"code":    200,
+	})
+}
+
+// DeleteOperator godoc
+//
+//	@Summary		Delete an operator
+//	@Description	Delete a back-office operator account
+//	@Tags			Backoffice - Operators
+//	@Produce		json
+//	@Security		BearerAuthBackOffice
+//	@Param			operator_id	path	int	true	"Operator ID"
+//	@Router			/delete_operator/{operator_id} [delete]
+func DeleteOperator(c *gin.Context) {
+	ctx := context.Background()
+	idStr := c.Param("operator_id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Warn().Err(err).Str("OperatorID", idStr).Msg("Invalid Operator ID")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid Operator ID",
+			"code":    -400,
+		})
+		return
+	}
+
+	rowsAffected, err := db.DeleteOperator(ctx, id)
+	middleware.ForgetOperator(id)
+	if err != nil {
+		log.Err(err).Msg("Error deleting operator")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to delete operator",
+			"code":    -500,
+		})
+		return
+	}
+
+	if rowsAffected == 0 {
+		log.Warn().Int("OperatorID", id).Msg("No operator found with the given ID")
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "No operator found with the given ID",
+			"code":    -404,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Operator deleted successfully",
+		"code":    200,
+	})
+}
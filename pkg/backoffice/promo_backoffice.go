@@ -0,0 +1,269 @@
+package backoffice
+
+import (
+	"context"
+	"eventy/pkg/db"
+	"eventy/pkg/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// checkPromoCode rejects settings the binding tags cannot express
+func checkPromoCode(promo *models.PromoCode) string {
+	if db.NormalizePromoCode(promo.Code) == "" {
+		return "Code is required"
+	}
+	if promo.DiscountType == models.PromoDiscountPercent && promo.DiscountValue > 100 {
+		return "A percentage discount cannot exceed 100"
+	}
+	if promo.MaxRedemptions < 0 || promo.PerUserLimit < 0 {
+		return "Redemption limits cannot be negative"
+	}
+	if promo.ValidFrom != nil && promo.ValidUntil != nil && !promo.ValidUntil.After(*promo.ValidFrom) {
+		return "valid_until must be after valid_from"
+	}
+	return ""
+}
+
+// GetPromoCodes godoc
+//
+//	@Summary		Get promo codes
+//	@Description	Get every promo code, or one with promo_id, with its redemption count
+//	@Tags			Backoffice - Promo codes
+//	@Produce		json
+//	@Security		BearerAuthBackOffice
+//	@Param			promo_id	query	string				false	"Promo code ID"
+//	@Success		200			{array}	models.PromoCode	"List of Promo codes"
+//	@Router			/get_promo_codes [get]
+func GetPromoCodes(c *gin.Context) {
+	ctx := context.Background()
+	idStr := c.Query("promo_id")
+
+	if idStr != "" {
+		id, _ := strconv.Atoi(idStr)
+		promo, err := db.GetPromoCodeByID(ctx, id)
+		if err != nil {
+			log.Warn().Err(err).Str("PromoID", idStr).Msg("Error retrieving Promo code ID")
+			c.JSON(http.StatusOK, []models.PromoCode{})
+			return
+		}
+
+		c.JSON(http.StatusOK, promo)
+		return
+	}
+
+	promos, err := db.GetPromoCodes(ctx)
+	if err != nil {
+		log.Err(err).Msg("Error getting promo codes")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "An unexpected error occurred. Please try again later.",
+			"code":    -500,
+		})
+		return
+	}
+
+	if len(promos) == 0 {
+		log.Debug().Int("Promo code List", len(promos)).Msg("No data found")
+		c.JSON(http.StatusOK, []models.PromoCode{})
+		return
+	}
+
+	c.JSON(http.StatusOK, promos)
+}
+
+// AddPromoCode godoc
+//
+//	@Summary		Add a promo code
+//	@Description	Add a percentage or fixed discount, optionally scoped to events or categories, redeemable once is_active is true
+//	@Tags			Backoffice - Promo codes
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuthBackOffice
+//	@Param			promo	body	models.PromoCode	true	"Promo code data"
+//	@Router			/add_promo_code [post]
+func AddPromoCode(c *gin.Context) {
+	ctx := context.Background()
+	var promo models.PromoCode
+
+	if err := c.ShouldBindJSON(&promo); err != nil {
+		log.Warn().Err(err).Msg("Invalid request payload")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request payload",
+			"code":    -400,
+		})
+		return
+	}
+	if msg := checkPromoCode(&promo); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": msg,
+			"code":    -400,
+		})
+		return
+	}
+
+	if _, err := db.GetPromoCodeByCode(ctx, promo.Code); err == nil {
+		log.Warn().Str("Code", promo.Code).Msg("Promo code already exists")
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "Promo code already exists",
+			"code":    -409,
+		})
+		return
+	}
+
+	if err := db.AddPromoCode(ctx, &promo); err != nil {
+		log.Err(err).Msg("Error adding promo code")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to add promo code",
+			"code":    -500,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"message":  "Promo code added successfully",
+		"promo_id": promo.PromoID,
+		"code":     200,
+	})
+}
+
+// UpdatePromoCode godoc
+//
+//	@Summary		Update a promo code
+//	@Description	Replace the settings of a promo code, bookings already made keep their price
+//	@Tags			Backoffice - Promo codes
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuthBackOffice
+//	@Param			promo_id	path	int					true	"Promo code ID"
+//	@Param			promo		body	models.PromoCode	true	"Updated promo code data"
+//	@Router			/update_promo_code/{promo_id} [put]
+func UpdatePromoCode(c *gin.Context) {
+	ctx := context.Background()
+	idStr := c.Param("promo_id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Warn().Err(err).Str("PromoID", idStr).Msg("Invalid Promo code ID")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid Promo code ID",
+			"code":    -400,
+		})
+		return
+	}
+
+	var promo models.PromoCode
+	if err := c.ShouldBindJSON(&promo); err != nil {
+		log.Warn().Err(err).Msg("Invalid request payload")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request payload",
+			"code":    -400,
+		})
+		return
+	}
+	if msg := checkPromoCode(&promo); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": msg,
+			"code":    -400,
+		})
+		return
+	}
+
+	if existing, err := db.GetPromoCodeByCode(ctx, promo.Code); err == nil && existing.PromoID != id {
+		log.Warn().Str("Code", promo.Code).Msg("Promo code already exists")
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "Promo code already exists",
+			"code":    -409,
+		})
+		return
+	}
+
+	rowsAffected, err := db.UpdatePromoCode(ctx, id, &promo)
+	if err != nil {
+		log.Err(err).Msg("Error updating promo code")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to update promo code",
+			"code":    -500,
+		})
+		return
+	}
+
+	if rowsAffected == 0 {
+		log.Warn().Int("PromoID", id).Msg("No promo code found with the given ID")
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "No promo code found with the given ID",
+			"code":    -404,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Promo code updated successfully",
+		"code":    200,
+	})
+}
+
+// DeletePromoCode godoc
+//
+//	@Summary		Delete a promo code
+//	@Description	Delete a promo code, bookings keep the code they were priced with
+//	@Tags			Backoffice - Promo codes
+//	@Produce		json
+//	@Security		BearerAuthBackOffice
+//	@Param			promo_id	path	int	true	"Promo code ID"
+//	@Router			/delete_promo_code/{promo_id} [delete]
+func DeletePromoCode(c *gin.Context) {
+	ctx := context.Background()
+	idStr := c.Param("promo_id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Warn().Err(err).Str("PromoID", idStr).Msg("Invalid Promo code ID")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid Promo code ID",
+			"code":    -400,
+		})
+		return
+	}
+
+	rowsAffected, err := db.DeletePromoCode(ctx, id)
+	if err != nil {
+		log.Err(err).Msg("Error deleting promo code")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to delete promo code",
+			"code":    -500,
+		})
+		return
+	}
+
+	if rowsAffected == 0 {
+		log.Warn().Int("PromoID", id).Msg("No promo code found with the given ID")
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "No promo code found with the given ID",
+			"code":    -404,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Promo code deleted successfully",
+		"code":    200,
+	})
+}
@@ -0,0 +1,60 @@
+package backoffice
+
+import (
+	"eventy/pkg/throttle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// GetLockedAccounts godoc
+//
+//	@Summary		Get locked accounts
+//	@Description	List the accounts and client IPs locked out after too many failed logins
+//	@Tags			Backoffice - Security
+//	@Produce		json
+//	@Security		BearerAuthBackOffice
+//	@Success		200	{array}	throttle.Entry	"Locked keys"
+//	@Router			/get_locked_accounts [get]
+func GetLockedAccounts(c *gin.Context) {
+	c.JSON(http.StatusOK, throttle.Login().Locked())
+}
+
+// UnlockAccount godoc
+//
+//	@Summary		Unlock an account
+//	@Description	Clear the failed login state of an account or client IP key
+//	@Tags			Backoffice - Security
+//	@Produce		json
+//	@Security		BearerAuthBackOffice
+//	@Param			key	query	string	true	"Key as listed by get_locked_accounts (e.g. account:mobile:john@doe.com)"
+//	@Router			/unlock_account [post]
+func UnlockAccount(c *gin.Context) {
+	key := c.Query("key")
+	if key == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request. 'key' parameter is required.",
+			"code":    -400,
+		})
+		return
+	}
+
+	if !throttle.Login().Unlock(key) {
+		log.Warn().Str("Key", key).Msg("No failed login state for key")
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "No locked account found with the given key",
+			"code":    -404,
+		})
+		return
+	}
+
+	log.Info().Str("Key", key).Msg("Account unlocked")
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Account unlocked successfully",
+		"code":    200,
+	})
+}
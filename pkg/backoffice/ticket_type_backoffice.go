@@ -0,0 +1,245 @@
+package backoffice
+
+import (
+	"context"
+	"errors"
+	"eventy/pkg/db"
+	"eventy/pkg/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// ticketTypeError answers the errors of the ticket type operations, it returns false for unexpected errors
+func ticketTypeError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, db.ErrEventNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "No event found with the given ID",
+			"code":    -404,
+		})
+	case errors.Is(err, db.ErrTicketTypeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "No ticket type found with the given ID",
+			"code":    -404,
+		})
+	case errors.Is(err, db.ErrTicketTypeQuota), errors.Is(err, db.ErrTicketTypeOversold), errors.Is(err, db.ErrTicketTypeInUse):
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": err.Error(),
+			"code":    -409,
+		})
+	default:
+		return false
+	}
+	return true
+}
+
+// bindTicketType binds and checks a ticket type payload, it answers the request when invalid
+func bindTicketType(c *gin.Context, ticketType *models.TicketType) bool {
+	if err := c.ShouldBindJSON(ticketType); err != nil {
+		log.Warn().Err(err).Msg("Invalid request payload")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request payload",
+			"code":    -400,
+		})
+		return false
+	}
+	if ticketType.SalesStart != nil && ticketType.SalesEnd != nil && !ticketType.SalesEnd.After(*ticketType.SalesStart) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "sales_end must be after sales_start",
+			"code":    -400,
+		})
+		return false
+	}
+	return true
+}
+
+// GetTicketTypes godoc
+//
+//	@Summary		Get ticket types
+//	@Description	Get the ticket types of an event with their sold and remaining stock
+//	@Tags			Backoffice - Ticket types
+//	@Produce		json
+//	@Security		BearerAuthBackOffice
+//	@Param			event_id	query	int					true	"Event ID"
+//	@Success		200			{array}	models.TicketType	"List of Ticket types"
+//	@Router			/get_ticket_types [get]
+func GetTicketTypes(c *gin.Context) {
+	ctx := context.Background()
+	eventID, err := strconv.Atoi(c.Query("event_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request. 'event_id' parameter is required.",
+			"code":    -400,
+		})
+		return
+	}
+
+	types, err := db.GetTicketTypesByEvent(ctx, eventID)
+	if err != nil {
+		log.Err(err).Int("EventID", eventID).Msg("Error getting ticket types")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "An unexpected error occurred. Please try again later.",
+			"code":    -500,
+		})
+		return
+	}
+
+	if len(types) == 0 {
+		c.JSON(http.StatusOK, []models.TicketType{})
+		return
+	}
+
+	c.JSON(http.StatusOK, types)
+}
+
+// AddTicketType godoc
+//
+//	@Summary		Add a ticket type
+//	@Description	Add a price tier to an event, the quotas of its ticket types must fit in the event capacity
+//	@Tags			Backoffice - Ticket types
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuthBackOffice
+//	@Param			ticket_type	body	models.TicketType	true	"Ticket type data"
+//	@Router			/add_ticket_type [post]
+func AddTicketType(c *gin.Context) {
+	ctx := context.Background()
+	var ticketType models.TicketType
+	if !bindTicketType(c, &ticketType) {
+		return
+	}
+
+	if err := db.AddTicketType(ctx, &ticketType); err != nil {
+		if ticketTypeError(c, err) {
+			return
+		}
+		log.Err(err).Msg("Error adding ticket type")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to add ticket type",
+			"code":    -500,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":        true,
+		"message":        "Ticket type added successfully",
+		"ticket_type_id": ticketType.TicketTypeID,
+		"code":           200,
+	})
+}
+
+// UpdateTicketType godoc
+//
+//	@Summary		Update a ticket type
+//	@Description	Replace the name, price, quota and sale window of a ticket type, bookings already made keep their price
+//	@Tags			Backoffice - Ticket types
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuthBackOffice
+//	@Param			ticket_type_id	path	int					true	"Ticket type ID"
+//	@Param			ticket_type		body	models.TicketType	true	"Updated ticket type data"
+//	@Router			/update_ticket_type/{ticket_type_id} [put]
+func UpdateTicketType(c *gin.Context) {
+	ctx := context.Background()
+	idStr := c.Param("ticket_type_id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Warn().Err(err).Str("TicketTypeID", idStr).Msg("Invalid Ticket type ID")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid Ticket type ID",
+			"code":    -400,
+		})
+		return
+	}
+
+	var ticketType models.TicketType
+	if !bindTicketType(c, &ticketType) {
+		return
+	}
+
+	if err := db.UpdateTicketType(ctx, id, &ticketType); err != nil {
+		if ticketTypeError(c, err) {
+			return
+		}
+		log.Err(err).Msg("Error updating ticket type")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to update ticket type",
+			"code":    -500,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Ticket type updated successfully",
+		"code":    200,
+	})
+}
+
+// DeleteTicketType godoc
+//
+//	@Summary		Delete a ticket type
+//	@Description	Delete a ticket type no booking holds a seat of
+//	@Tags			Backoffice - Ticket types
+//	@Produce		json
+//	@Security		BearerAuthBackOffice
+//	@Param			ticket_type_id	path	int	true	"Ticket type ID"
+//	@Router			/delete_ticket_type/{ticket_type_id} [delete]
+func DeleteTicketType(c *gin.Context) {
+	ctx := context.Background()
+	idStr := c.Param("ticket_type_id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Warn().Err(err).Str("TicketTypeID", idStr).Msg("Invalid Ticket type ID")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid Ticket type ID",
+			"code":    -400,
+		})
+		return
+	}
+
+	rowsAffected, err := db.DeleteTicketType(ctx, id)
+	if err != nil {
+		if ticketTypeError(c, err) {
+			return
+		}
+		log.Err(err).Msg("Error deleting ticket type")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to delete ticket type",
+			"code":    -500,
+		})
+		return
+	}
+
+	if rowsAffected == 0 {
+		log.Warn().Int("TicketTypeID", id).Msg("No ticket type found with the given ID")
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "No ticket type found with the given ID",
+			"code":    -404,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Ticket type deleted successfully",
+		"code":    200,
+	})
+}
@@ -2,10 +2,13 @@ package backoffice
 
 import (
 	"context"
+	"errors"
+	"eventy/middleware"
 	"eventy/pkg/db"
 	"eventy/pkg/models"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
@@ -135,7 +138,16 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 
-	rowsAffected, err := db.UpdateUser(ctx, id, &updates)
+	rowsAffected, _, err := db.UpdateUser(ctx, id, &updates)
+	if errors.Is(err, db.ErrEmailTaken) {
+		log.Warn().Int("UserID", id).Msg("Email already used by another user")
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "Email already used by another user",
+			"code":    -409,
+		})
+		return
+	}
 	if err != nil {
 		log.Err(err).Msg("Error updating user")
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -213,12 +225,19 @@ func DeleteUser(c *gin.Context) {
 	})
 }
 
-func TopupBalance(c *gin.Context) {
-	ctx := context.Background()
-	//var user models.User
-	idStr := c.Query("user_id")
-	balanceStr := c.Query("balance")
-
+// TopupUserBalance godoc
+//
+//	@Summary		Adjust a user balance
+//	@Description	Credit, or debit with a negative amount, the wallet of any user (finance operators) to correct a mistake. The adjustment is recorded in the ledger with the operator and reason, a debit cannot overdraw the wallet
+//	@Tags			Backoffice - Users
+//	@Produce		json
+//	@Security		BearerAuthBackOffice
+//	@Param			user_id	path	int	true	"User ID"
+//	@Param			balance	query	int		true	"Amount to credit, negative to debit"
+//	@Param			reason	query	string	true	"Reason of the adjustment"
+//	@Router			/topup_balance/{user_id} [put]
+func TopupUserBalance(c *gin.Context) {
+	idStr := c.Param("user_id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
 		log.Warn().Err(err).Str("UserID", idStr).Msg("Invalid User ID")
@@ -230,29 +249,40 @@ func TopupBalance(c *gin.Context) {
 		return
 	}
 
+	ctx := context.Background()
+	balanceStr := c.Query("balance")
+
 	balance, err := strconv.Atoi(balanceStr)
-	if err != nil {
-		log.Warn().Err(err).Str("UserID", idStr).Msg("Invalid User ID")
+	if err != nil || balance == 0 {
+		log.Warn().Str("Balance", balanceStr).Msg("Invalid balance")
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"message": "Invalid User ID",
+			"message": "Invalid balance, a non-zero amount is required",
 			"code":    -400,
 		})
 		return
 	}
 
-	rowsAffected, err := db.TopupBalance(ctx, id, balance)
-	if err != nil {
-		log.Err(err).Msg("Error occured")
-		c.JSON(http.StatusInternalServerError, gin.H{
+	reason := strings.TrimSpace(c.Query("reason"))
+	if reason == "" {
+		log.Warn().Int("UserID", id).Msg("Balance adjustment without a reason")
+		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"message": "Failed to topup balance",
-			"code":    -500,
+			"message": "A reason is required for a balance adjustment",
+			"code":    -400,
 		})
 		return
 	}
 
-	if rowsAffected == 0 {
+	entry := models.WalletTransaction{
+		UserID:  id,
+		Amount:  balance,
+		RefType: models.WalletRefAdjustment,
+		Reason:  reason,
+		Actor:   middleware.Actor(c),
+	}
+	err = db.PostWalletTransaction(ctx, &entry)
+	if errors.Is(err, db.ErrUserNotFound) {
 		log.Warn().Int("UserID", id).Msg("No user found with the given ID")
 		c.JSON(http.StatusNotFound, gin.H{
 			"success": false,
@@ -261,10 +291,32 @@ func TopupBalance(c *gin.Context) {
 		})
 		return
 	}
+	if errors.Is(err, db.ErrInsufficientBalance) {
+		log.Warn().Int("UserID", id).Int("Amount", balance).Msg("Balance adjustment would overdraw the wallet")
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "The debit exceeds the user balance",
+			"code":    -409,
+		})
+		return
+	}
+	if err != nil {
+		log.Err(err).Msg("Error occured")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to adjust balance",
+			"code":    -500,
+		})
+		return
+	}
+
+	log.Info().Msgf("Balance of user %d adjusted by %d by %s: %s", id, balance, entry.Actor, reason)
 
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "User Balance Topuped successfully",
-		"code":    200,
+		"success":     true,
+		"message":     "User balance adjusted successfully",
+		"balance":     entry.BalanceAfter,
+		"transaction": entry,
+		"code":        200,
 	})
 }
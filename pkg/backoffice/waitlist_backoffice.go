@@ -0,0 +1,53 @@
+package backoffice
+
+import (
+	"context"
+	"eventy/pkg/db"
+	"eventy/pkg/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// GetWaitlist godoc
+//
+//	@Summary		Get the waitlist of an event
+//	@Description	Get every waitlist entry of an event in queue order, with the position of waiting users
+//	@Tags			Backoffice - Bookings
+//	@Produce		json
+//	@Security		BearerAuthBackOffice
+//	@Param			event_id	query	string	true	"Event ID"
+//	@Success		200			{array}	models.WaitlistEntry	"Waitlist"
+//	@Router			/get_waitlist [get]
+func GetWaitlist(c *gin.Context) {
+	ctx := context.Background()
+	eventID, err := strconv.Atoi(c.Query("event_id"))
+	if err != nil || eventID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request. 'event_id' parameter is required.",
+			"code":    -400,
+		})
+		return
+	}
+
+	entries, err := db.GetWaitlistByEvent(ctx, eventID)
+	if err != nil {
+		log.Err(err).Int("EventID", eventID).Msg("Error getting waitlist")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "An unexpected error occurred. Please try again later.",
+			"code":    -500,
+		})
+		return
+	}
+
+	if len(entries) == 0 {
+		c.JSON(http.StatusOK, []models.WaitlistEntry{})
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
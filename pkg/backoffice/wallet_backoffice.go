@@ -0,0 +1,64 @@
+package backoffice
+
+import (
+	"context"
+	"eventy/pkg/db"
+	"eventy/pkg/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// GetWalletTransactions godoc
+//
+//	@Summary		Get the wallet ledger of a user
+//	@Description	Get the wallet transactions of a user, newest first, with the balance derived from the ledger
+//	@Tags			Backoffice - Wallet
+//	@Produce		json
+//	@Security		BearerAuthBackOffice
+//	@Param			user_id	query	int	true	"User ID"
+//	@Param			limit	query	int	false	"Page size"
+//	@Param			offset	query	int	false	"Page offset"
+//	@Router			/get_wallet_transactions [get]
+func GetWalletTransactions(c *gin.Context) {
+	ctx := context.Background()
+	userID, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil || userID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request. 'user_id' parameter is required.",
+			"code":    -400,
+		})
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+
+	entries, err := db.GetWalletTransactions(ctx, userID, limit, offset)
+	if err != nil {
+		log.Err(err).Int("UserID", userID).Msg("Error getting wallet transactions")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "An unexpected error occurred. Please try again later.",
+			"code":    -500,
+		})
+		return
+	}
+	if entries == nil {
+		entries = []models.WalletTransaction{}
+	}
+
+	ledgerBalance, err := db.GetLedgerBalance(ctx, userID)
+	if err != nil {
+		log.Err(err).Int("UserID", userID).Msg("Error summing wallet transactions")
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":        true,
+		"ledger_balance": ledgerBalance,
+		"transactions":   entries,
+		"code":           200,
+	})
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"eventy/pkg/models"
+	"fmt"
+
+	"github.com/uptrace/bun"
+)
+
+// withEventAttendees selects the event columns plus the users holding an active booking
+func withEventAttendees(q *bun.SelectQuery) *bun.SelectQuery {
+	return q.ColumnExpr("?TableAlias.*").
+		ColumnExpr(`ARRAY(SELECT b.user_id FROM booking AS b WHERE b.event_id = ?TableAlias.event_id AND b.status IN (?) ORDER BY b.booking_id) AS user_id`,
+			bun.In(models.BookingActiveStatuses))
+}
+
+// withUserBookings selects the user columns plus the events the user holds an active booking for
+func withUserBookings(q *bun.SelectQuery) *bun.SelectQuery {
+	return q.ColumnExpr("?TableAlias.*").
+		ColumnExpr(`ARRAY(SELECT b.event_id FROM booking AS b WHERE b.user_id = ?TableAlias.user_id AND b.status IN (?) ORDER BY b.booking_id) AS event_id`,
+			bun.In(models.BookingActiveStatuses))
+}
+
+// countActiveSeats returns the number of seats taken on an event, pending payments included
+func countActiveSeats(ctx context.Context, db bun.IDB, eventID int) (int, error) {
+	var count int
+	err := db.NewSelect().
+		Model((*models.Booking)(nil)).
+		ColumnExpr("COALESCE(SUM(seats), 0)").
+		Where("event_id = ?", eventID).
+		Where("status IN (?)", bun.In(models.BookingHeldStatuses)).
+		Scan(ctx, &count)
+	if err != nil {
+		return 0, fmt.Errorf("error counting bookings of event with ID %d: %w", eventID, err)
+	}
+	return count, nil
+}
+
+// hasActiveBooking reports whether the user already holds a seat on the event
+func hasActiveBooking(ctx context.Context, db bun.IDB, eventID, userID int) (bool, error) {
+	exists, err := db.NewSelect().
+		Model((*models.Booking)(nil)).
+		Where("event_id = ?", eventID).
+		Where("user_id = ?", userID).
+		Where("status IN (?)", bun.In(models.BookingHeldStatuses)).
+		Exists(ctx)
+	if err != nil {
+		return false, fmt.Errorf("error checking booking of user %d on event %d: %w", userID, eventID, err)
+	}
+	return exists, nil
+}
+
+// lockBooking locks the event of a booking, then the booking itself. Every transaction takes the
+// event row before the rows hanging off it, a booking is never locked on its own.
+func lockBooking(ctx context.Context, tx bun.Tx, bookingID int) (*models.Booking, error) {
+	// The event of a booking never changes, it is safe to read it before holding any lock
+	var eventID int
+	err := tx.NewSelect().
+		Model((*models.Booking)(nil)).
+		Column("event_id").
+		Where("booking_id = ?", bookingID).
+		Scan(ctx, &eventID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrBookingNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching booking with ID %d: %w", bookingID, err)
+	}
+
+	_, err = tx.NewSelect().
+		Model((*models.Event)(nil)).
+		Column("event_id").
+		Where("event_id = ?", eventID).
+		For("UPDATE").
+		Exec(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error locking event with ID %d: %w", eventID, err)
+	}
+
+	booking := new(models.Booking)
+	err = tx.NewSelect().
+		Model(booking).
+		Where("booking_id = ?", bookingID).
+		For("UPDATE").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching booking with ID %d: %w", bookingID, err)
+	}
+	return booking, nil
+}
+
+// GetBookingByID retrieves a single booking by its ID
+func GetBookingByID(ctx context.Context, id int) (*models.Booking, error) {
+	booking := new(models.Booking)
+	err := Db_GlobalVar.NewSelect().Model(booking).Where("booking_id = ?", id).Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting booking by ID %d: %w", id, err)
+	}
+	return booking, nil
+}
+
+// GetBookingsByUser retrieves every booking of a user, newest first
+func GetBookingsByUser(ctx context.Context, userID int) ([]models.Booking, error) {
+	var bookings []models.Booking
+	err := Db_GlobalVar.NewSelect().
+		Model(&bookings).
+		Where("user_id = ?", userID).
+		Order("booking_id DESC").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting bookings of user with ID %d: %w", userID, err)
+	}
+	return bookings, nil
+}
+
+// GetBookingsByEvent retrieves every booking of an event
+func GetBookingsByEvent(ctx context.Context, eventID int) ([]models.Booking, error) {
+	var bookings []models.Booking
+	err := Db_GlobalVar.NewSelect().
+		Model(&bookings).
+		Where("event_id = ?", eventID).
+		Order("booking_id").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting bookings of event with ID %d: %w", eventID, err)
+	}
+	return bookings, nil
+}
@@ -0,0 +1,349 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"eventy/config"
+	"eventy/pkg/db"
+	"eventy/pkg/db/dbtest"
+	"eventy/pkg/models"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// bookConcurrently fires one BookEvent per user at the same time and returns the bookings made
+func bookConcurrently(t *testing.T, eventID int, users []*models.User, seats int) []*models.Booking {
+	t.Helper()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		bookings []*models.Booking
+		start    = make(chan struct{})
+	)
+	for _, user := range users {
+		wg.Add(1)
+		go func(userID int) {
+			defer wg.Done()
+			<-start
+			booking, err := db.BookEvent(context.Background(), eventID, userID, db.BookingOptions{Seats: seats})
+			if err != nil {
+				if !errors.Is(err, db.ErrEventFull) {
+					t.Errorf("booking of user %d: unexpected error %v", userID, err)
+				}
+				return
+			}
+			mu.Lock()
+			bookings = append(bookings, booking)
+			mu.Unlock()
+		}(user.UserID)
+	}
+	close(start)
+	wg.Wait()
+	return bookings
+}
+
+// checkWallets verifies each user paid exactly for their own booking and the ledger matches the balance
+func checkWallets(t *testing.T, users []*models.User, bookings []*models.Booking) {
+	t.Helper()
+
+	paid := make(map[int]int)
+	for _, booking := range bookings {
+		paid[booking.UserID] += booking.PricePaid
+	}
+	for _, user := range users {
+		stored, ledger := dbtest.Balances(t, user.UserID)
+		if stored != ledger {
+			t.Errorf("user %d: balance %d does not match ledger %d", user.UserID, stored, ledger)
+		}
+		if want := user.Balance - paid[user.UserID]; stored != want {
+			t.Errorf("user %d: balance %d, want %d", user.UserID, stored, want)
+		}
+	}
+}
+
+func countSeats(t *testing.T, eventID int) int {
+	t.Helper()
+
+	bookings, err := db.GetBookingsByEvent(context.Background(), eventID)
+	if err != nil {
+		t.Fatalf("getting bookings: %v", err)
+	}
+	seats := 0
+	for _, booking := range bookings {
+		if booking.Status == models.BookingStatusConfirmed {
+			seats += booking.Seats
+		}
+	}
+	return seats
+}
+
+func TestBookEventNeverOversells(t *testing.T) {
+	dbtest.Open(t)
+
+	const (
+		capacity = 5
+		bookers  = 40
+		price    = 300
+	)
+	event := dbtest.NewEvent(t, capacity, price)
+	users := make([]*models.User, bookers)
+	for i := range users {
+		users[i] = dbtest.NewUser(t, 1000)
+	}
+
+	bookings := bookConcurrently(t, event.EventID, users, 1)
+
+	if len(bookings) != capacity {
+		t.Errorf("%d bookings made, want exactly %d", len(bookings), capacity)
+	}
+	if seats := countSeats(t, event.EventID); seats != capacity {
+		t.Errorf("%d seats confirmed, want %d", seats, capacity)
+	}
+	checkWallets(t, users, bookings)
+}
+
+func TestGroupBookingsTakeAllSeatsOrNone(t *testing.T) {
+	dbtest.Open(t)
+
+	const (
+		capacity = 5
+		bookers  = 20
+		group    = 2
+		price    = 100
+	)
+	event := dbtest.NewEvent(t, capacity, price)
+	users := make([]*models.User, bookers)
+	for i := range users {
+		users[i] = dbtest.NewUser(t, 1000)
+	}
+
+	bookings := bookConcurrently(t, event.EventID, users, group)
+
+	// Two groups fit, a third would need a seat more than the one left
+	if want := capacity / group; len(bookings) != want {
+		t.Errorf("%d group bookings made, want %d", len(bookings), want)
+	}
+	if seats, want := countSeats(t, event.EventID), capacity/group*group; seats != want {
+		t.Errorf("%d seats confirmed, want %d", seats, want)
+	}
+	for _, booking := range bookings {
+		if booking.PricePaid != group*price {
+			t.Errorf("booking %d paid %d, want %d", booking.BookingID, booking.PricePaid, group*price)
+		}
+		tickets, err := db.GetTicketsByBooking(context.Background(), booking.BookingID)
+		if err != nil {
+			t.Fatalf("getting tickets: %v", err)
+		}
+		if len(tickets) != group {
+			t.Errorf("booking %d has %d tickets, want %d", booking.BookingID, len(tickets), group)
+		}
+	}
+	checkWallets(t, users, bookings)
+}
+
+// pendingCardBooking holds a seat of the user on the event with a card payment waiting for the provider
+func pendingCardBooking(t *testing.T, eventID int, user *models.User, opts db.BookingOptions) (*models.Booking, *models.Payment) {
+	t.Helper()
+	ctx := context.Background()
+
+	booking, quote, err := db.CreatePendingBooking(ctx, eventID, user.UserID, opts)
+	if err != nil {
+		t.Fatalf("holding a seat: %v", err)
+	}
+	payment := &models.Payment{
+		Provider:    "test",
+		ProviderRef: fmt.Sprintf("pi_test_%d_%d", time.Now().UnixNano(), booking.BookingID),
+		Purpose:     models.PaymentPurposeBooking,
+		UserID:      user.UserID,
+		EventID:     eventID,
+		BookingID:   booking.BookingID,
+		Amount:      quote.Total,
+		Currency:    quote.Currency,
+	}
+	if err := db.AddPayment(ctx, payment); err != nil {
+		t.Fatalf("adding payment: %v", err)
+	}
+	return booking, payment
+}
+
+// succeedPayment reports the whole payment as received by the provider
+func succeedPayment(t *testing.T, payment *models.Payment) *db.PaymentEventResult {
+	t.Helper()
+	result, _, err := db.HandlePaymentEvent(context.Background(), payment.Provider, models.PaymentEvent{
+		ID:          "evt_" + payment.ProviderRef,
+		Type:        "payment.succeeded",
+		Kind:        models.PaymentEventSucceeded,
+		ProviderRef: payment.ProviderRef,
+		Amount:      payment.Amount,
+		Currency:    payment.Currency,
+	})
+	if err != nil {
+		t.Fatalf("handling payment %s: %v", payment.ProviderRef, err)
+	}
+	return result
+}
+
+func TestLatePaymentKeepsPromoLimits(t *testing.T) {
+	dbtest.Open(t)
+	ctx := context.Background()
+
+	event := dbtest.NewEvent(t, 10, 1000)
+	promo := &models.PromoCode{
+		Code:           fmt.Sprintf("ONCE%d", time.Now().UnixNano()),
+		DiscountType:   models.PromoDiscountPercent,
+		DiscountValue:  20,
+		MaxRedemptions: 1,
+		IsActive:       true,
+	}
+	if err := db.AddPromoCode(ctx, promo); err != nil {
+		t.Fatalf("adding promo code: %v", err)
+	}
+
+	// The hold of the card booking expires and the only redemption goes to someone else
+	late, payment := pendingCardBooking(t, event.EventID, dbtest.NewUser(t, 0), db.BookingOptions{Seats: 1, PromoCode: promo.Code})
+	if _, err := db.ReleasePendingBooking(ctx, late.BookingID); err != nil {
+		t.Fatalf("releasing booking: %v", err)
+	}
+	if _, err := db.BookEvent(ctx, event.EventID, dbtest.NewUser(t, 1000).UserID, db.BookingOptions{Seats: 1, PromoCode: promo.Code}); err != nil {
+		t.Fatalf("booking with the promo code: %v", err)
+	}
+
+	result := succeedPayment(t, payment)
+
+	late, err := db.GetBookingByID(ctx, late.BookingID)
+	if err != nil {
+		t.Fatalf("getting booking: %v", err)
+	}
+	if late.Status != models.BookingStatusCancelled {
+		t.Errorf("late booking %s, want it kept cancelled", late.Status)
+	}
+	if result.Refund == nil || result.Refund.Amount != payment.Amount || result.Refund.Method != models.RefundMethodCard {
+		t.Errorf("refund %+v, want a card refund of %d", result.Refund, payment.Amount)
+	}
+	redeemed, err := db.GetPromoCodeByID(ctx, promo.PromoID)
+	if err != nil {
+		t.Fatalf("getting promo code: %v", err)
+	}
+	if redeemed.Redemptions != 1 {
+		t.Errorf("promo code redeemed %d times, want 1", redeemed.Redemptions)
+	}
+}
+
+func TestPaymentAndEventDecisionDoNotDeadlock(t *testing.T) {
+	dbtest.Open(t)
+
+	saved := config.Configvar.Booking.DecisionHours
+	config.Configvar.Booking.DecisionHours = 48
+	t.Cleanup(func() { config.Configvar.Booking.DecisionHours = saved })
+
+	const (
+		rounds = 10
+		price  = 400
+	)
+	ctx := context.Background()
+
+	// No other test starts its events that day, deciding it only touches the events made here
+	start := time.Now().AddDate(5, 0, 0)
+	decideAt := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.Local).Add(-time.Hour)
+
+	for round := 0; round < rounds; round++ {
+		event := dbtest.NewEvent(t, 10, price)
+		_, err := db.Db_GlobalVar.NewUpdate().
+			Model((*models.Event)(nil)).
+			Set("start_date = ?", start.Format("2006-01-02")).
+			Set("end_date = ?", start.Format("2006-01-02")).
+			Set("min_capacity = ?", 5).
+			Where("event_id = ?", event.EventID).
+			Exec(ctx)
+		if err != nil {
+			t.Fatalf("moving event %d: %v", event.EventID, err)
+		}
+
+		// One wallet booking for the decision to cancel, one card booking paid at the same time
+		walletUser := dbtest.NewUser(t, 1000)
+		if _, err := db.BookEvent(ctx, event.EventID, walletUser.UserID, db.BookingOptions{Seats: 1}); err != nil {
+			t.Fatalf("booking: %v", err)
+		}
+		booking, payment := pendingCardBooking(t, event.EventID, dbtest.NewUser(t, 0), db.BookingOptions{Seats: 1})
+
+		var (
+			wg          sync.WaitGroup
+			paymentErr  error
+			decisionErr error
+			begin       = make(chan struct{})
+		)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			<-begin
+			_, _, paymentErr = db.HandlePaymentEvent(ctx, payment.Provider, models.PaymentEvent{
+				ID:          "evt_" + payment.ProviderRef,
+				Type:        "payment.succeeded",
+				Kind:        models.PaymentEventSucceeded,
+				ProviderRef: payment.ProviderRef,
+				Amount:      payment.Amount,
+				Currency:    payment.Currency,
+			})
+		}()
+		go func() {
+			defer wg.Done()
+			<-begin
+			_, decisionErr = db.DecideEvents(ctx, decideAt)
+		}()
+		close(begin)
+		wg.Wait()
+
+		if paymentErr != nil {
+			t.Fatalf("round %d: payment: %v", round, paymentErr)
+		}
+		if decisionErr != nil {
+			t.Fatalf("round %d: decision: %v", round, decisionErr)
+		}
+
+		// Whichever went first, the event is cancelled and the card booking refunded in full
+		booking, err = db.GetBookingByID(ctx, booking.BookingID)
+		if err != nil {
+			t.Fatalf("getting booking: %v", err)
+		}
+		if booking.Status != models.BookingStatusCancelled {
+			t.Errorf("round %d: card booking %s, want cancelled", round, booking.Status)
+		}
+		refunds, err := db.GetRefunds(ctx, booking.BookingID, 0)
+		if err != nil {
+			t.Fatalf("getting refunds: %v", err)
+		}
+		refunded := 0
+		for _, refund := range refunds {
+			refunded += refund.Amount
+		}
+		if refunded != payment.Amount {
+			t.Errorf("round %d: card booking refunded %d, want %d", round, refunded, payment.Amount)
+		}
+	}
+}
+
+func TestWalletRefusesEventsInAnotherCurrency(t *testing.T) {
+	dbtest.Open(t)
+	ctx := context.Background()
+
+	event := dbtest.NewEvent(t, 10, 2500)
+	_, err := db.Db_GlobalVar.NewUpdate().
+		Model((*models.Event)(nil)).
+		Set("currency = ?", "eur").
+		Where("event_id = ?", event.EventID).
+		Exec(ctx)
+	if err != nil {
+		t.Fatalf("repricing event %d: %v", event.EventID, err)
+	}
+	user := dbtest.NewUser(t, 5000)
+
+	if _, err := db.BookEvent(ctx, event.EventID, user.UserID, db.BookingOptions{Seats: 1}); !errors.Is(err, db.ErrWalletCurrency) {
+		t.Fatalf("booking a eur event from a %s wallet: got %v, want ErrWalletCurrency", dbtest.Currency, err)
+	}
+	if stored, ledger := dbtest.Balances(t, user.UserID); stored != 5000 || ledger != 5000 {
+		t.Errorf("balance %d, ledger %d, want 5000 untouched", stored, ledger)
+	}
+}
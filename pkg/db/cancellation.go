@@ -0,0 +1,162 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"eventy/functions"
+	"eventy/pkg/models"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+)
+
+var (
+	ErrBookingNotFound  = errors.New("booking not found")
+	ErrBookingForbidden = errors.New("booking belongs to another user")
+	ErrBookingNotActive = errors.New("booking is not active")
+)
+
+// CancelBookingParams describes who cancels a booking and how the refund is computed
+type CancelBookingParams struct {
+	BookingID  int
+	OwnerID    int    // when set, the booking must belong to this user
+	Actor      string // audit actor, e.g. "user:12" or "operator:alice"
+	Reason     string
+	FullRefund bool // ignore the event policy and refund the full price
+}
+
+// RefundPercent applies the event cancellation policy at the given time
+func RefundPercent(event *models.Event, now time.Time) (int, error) {
+	start, err := functions.ParseEventDate(event.StartDate)
+	if err != nil {
+		return 0, err
+	}
+
+	// Compare calendar days: nothing is refunded on (or after) the day of the event
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	startDay := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, now.Location())
+	daysBefore := int(startDay.Sub(today).Hours() / 24)
+
+	switch {
+	case daysBefore <= 0:
+		return 0, nil
+	case daysBefore >= event.RefundFullDays:
+		return 100, nil
+	default:
+		return min(max(event.RefundPartialPercent, 0), 100), nil
+	}
+}
+
+// CancelBookingResult is the outcome of a cancellation
+type CancelBookingResult struct {
+	Booking    *models.Booking
+	Refund     *models.Refund
+	Promotions []models.WaitlistEntry // waitlist entries that received the freed seat
+}
+
+// CancelBooking frees the seat of a booking and refunds it according to the event policy,
+// to the wallet or, for card bookings, through a pending provider refund.
+// The refund, even a zero one, is recorded in the refund table and the seat goes to the waitlist.
+func CancelBooking(ctx context.Context, params CancelBookingParams) (*CancelBookingResult, error) {
+	result := new(CancelBookingResult)
+
+	err := Db_GlobalVar.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		result.Booking, result.Refund, err = cancelBooking(ctx, tx, params)
+		if err != nil {
+			return err
+		}
+
+		result.Promotions, err = promoteWaitlist(ctx, tx, result.Booking.EventID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Msgf("Booking %d cancelled by %s, refunded %d (%d%%)", result.Booking.BookingID, params.Actor, result.Refund.Amount, result.Refund.Percent)
+	return result, nil
+}
+
+// cancelBooking cancels and refunds a booking inside the caller transaction
+func cancelBooking(ctx context.Context, tx bun.Tx, params CancelBookingParams) (*models.Booking, *models.Refund, error) {
+	booking, err := lockBooking(ctx, tx, params.BookingID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if params.OwnerID != 0 && booking.UserID != params.OwnerID {
+		return nil, nil, ErrBookingForbidden
+	}
+	if booking.Status != models.BookingStatusConfirmed {
+		return nil, nil, ErrBookingNotActive
+	}
+
+	// Already locked with the booking
+	var event models.Event
+	err = tx.NewSelect().
+		Model(&event).
+		Column("event_id", "start_date", "refund_full_days", "refund_partial_percent").
+		Where("event_id = ?", booking.EventID).
+		Scan(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error fetching event with ID %d: %w", booking.EventID, err)
+	}
+
+	now := time.Now()
+	percent := 100
+	if !params.FullRefund {
+		percent, err = RefundPercent(&event, now)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error applying cancellation policy of event %d: %w", event.EventID, err)
+		}
+	}
+	amount := booking.PricePaid * percent / 100
+
+	booking.Status = models.BookingStatusCancelled
+	booking.CancelledAt = &now
+	_, err = tx.NewUpdate().
+		Model(booking).
+		Column("status", "cancelled_at").
+		WherePK().
+		Exec(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error cancelling booking with ID %d: %w", booking.BookingID, err)
+	}
+	if err := voidTickets(ctx, tx, booking.BookingID); err != nil {
+		return nil, nil, err
+	}
+
+	// A partial refund may already have been given back, never refund more than what is left
+	refunded, err := refundedAmount(ctx, tx, booking.BookingID)
+	if err != nil {
+		return nil, nil, err
+	}
+	amount = min(amount, max(booking.PricePaid-refunded, 0))
+
+	refund, err := issueRefund(ctx, tx, booking, amount, percent, params.Reason, params.Actor)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return booking, refund, nil
+}
+
+// GetRefunds retrieves refunds, optionally filtered by booking or user
+func GetRefunds(ctx context.Context, bookingID, userID int) ([]models.Refund, error) {
+	var refunds []models.Refund
+	q := Db_GlobalVar.NewSelect().Model(&refunds).Order("refund_id DESC")
+	if bookingID != 0 {
+		q = q.Where("booking_id = ?", bookingID)
+	}
+	if userID != 0 {
+		q = q.Where("user_id = ?", userID)
+	}
+
+	if err := q.Scan(ctx); err != nil {
+		return nil, fmt.Errorf("error getting refunds: %w", err)
+	}
+	return refunds, nil
+}
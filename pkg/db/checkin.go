@@ -0,0 +1,271 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"eventy/pkg/models"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+var (
+	ErrTicketWrongEvent   = errors.New("ticket is for another event")
+	ErrTicketVoid         = errors.New("ticket is no longer valid")
+	ErrAlreadyCheckedIn   = errors.New("ticket already checked in")
+	ErrCheckInUnavailable = errors.New("check-in is not open for this event")
+)
+
+// CheckInParams describes a scanned ticket
+type CheckInParams struct {
+	EventID int
+	Code    string
+	Gate    string
+	Staff   string    // audit actor of the scanner
+	At      time.Time // scan time, now when zero
+	Source  string    // online when empty
+	Device  string
+}
+
+// CheckIn validates a ticket code against the event and records the entry of its holder.
+// A ticket already checked in returns the check-in kept, the earliest scan, with ErrAlreadyCheckedIn.
+func CheckIn(ctx context.Context, params CheckInParams) (*models.CheckIn, *models.Ticket, error) {
+	var checkIn *models.CheckIn
+	t := new(models.Ticket)
+
+	var duplicate bool
+	err := Db_GlobalVar.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		checkIn, duplicate, err = checkInTicket(ctx, tx, t, params)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if duplicate {
+		return checkIn, t, ErrAlreadyCheckedIn
+	}
+	return checkIn, t, nil
+}
+
+// checkInTicket locks the ticket and records its check-in inside the caller transaction.
+// For a ticket already checked in it returns the check-in kept with duplicate set.
+func checkInTicket(ctx context.Context, tx bun.Tx, t *models.Ticket, params CheckInParams) (checkIn *models.CheckIn, duplicate bool, err error) {
+	err = tx.NewSelect().
+		Model(t).
+		Where("code = ?", strings.ToUpper(strings.TrimSpace(params.Code))).
+		For("UPDATE").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, ErrTicketNotFound
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("error fetching ticket %s: %w", params.Code, err)
+	}
+
+	if t.EventID != params.EventID {
+		return nil, false, ErrTicketWrongEvent
+	}
+
+	at := params.At
+	if at.IsZero() {
+		at = time.Now()
+	}
+	source := params.Source
+	if source == "" {
+		source = models.CheckInSourceOnline
+	}
+
+	existing := new(models.CheckIn)
+	err = tx.NewSelect().Model(existing).Where("ticket_id = ?", t.TicketID).For("UPDATE").Scan(ctx)
+	if err == nil {
+		// Scans uploaded late may predate the recorded one, the earliest scan is the entry
+		if at.Before(existing.CheckedInAt) {
+			existing.CheckedInAt = at
+			existing.Gate = params.Gate
+			existing.Staff = params.Staff
+			existing.Source = source
+			existing.DeviceID = params.Device
+			_, err := tx.NewUpdate().
+				Model(existing).
+				Column("checked_in_at", "gate", "staff", "source", "device_id").
+				WherePK().
+				Exec(ctx)
+			if err != nil {
+				return nil, false, fmt.Errorf("error updating check-in of ticket %d: %w", t.TicketID, err)
+			}
+		}
+		return existing, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, fmt.Errorf("error fetching check-in of ticket %d: %w", t.TicketID, err)
+	}
+
+	if t.Status != models.TicketStatusValid {
+		return nil, false, ErrTicketVoid
+	}
+
+	var event models.Event
+	err = tx.NewSelect().Model(&event).Column("event_id", "status").Where("event_id = ?", t.EventID).Scan(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("error fetching event with ID %d: %w", t.EventID, err)
+	}
+	if event.Status == models.EventStatusCancelled {
+		return nil, false, ErrCheckInUnavailable
+	}
+
+	checkIn = &models.CheckIn{
+		TicketID:    t.TicketID,
+		EventID:     t.EventID,
+		BookingID:   t.BookingID,
+		UserID:      t.UserID,
+		Gate:        params.Gate,
+		Staff:       params.Staff,
+		Source:      source,
+		DeviceID:    params.Device,
+		CheckedInAt: at,
+	}
+	if _, err := tx.NewInsert().Model(checkIn).Exec(ctx); err != nil {
+		return nil, false, fmt.Errorf("error recording check-in of ticket %d: %w", t.TicketID, err)
+	}
+	return checkIn, false, nil
+}
+
+// GetCheckInStats counts the valid tickets and check-ins of an event
+func GetCheckInStats(ctx context.Context, eventID int) (*models.CheckInStats, error) {
+	stats := &models.CheckInStats{EventID: eventID, ByGate: map[string]int{}}
+
+	booked, err := Db_GlobalVar.NewSelect().
+		Model((*models.Ticket)(nil)).
+		Where("event_id = ?", eventID).
+		Where("status = ?", models.TicketStatusValid).
+		Count(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error counting tickets of event %d: %w", eventID, err)
+	}
+	stats.Booked = booked
+
+	var gates []struct {
+		Gate  string `bun:"gate"`
+		Count int    `bun:"count"`
+	}
+	err = Db_GlobalVar.NewSelect().
+		Model((*models.CheckIn)(nil)).
+		ColumnExpr("COALESCE(gate, '') AS gate").
+		ColumnExpr("COUNT(*) AS count").
+		Where("event_id = ?", eventID).
+		GroupExpr("COALESCE(gate, '')").
+		Scan(ctx, &gates)
+	if err != nil {
+		return nil, fmt.Errorf("error counting check-ins of event %d: %w", eventID, err)
+	}
+	for _, g := range gates {
+		stats.ByGate[g.Gate] = g.Count
+		stats.CheckedIn += g.Count
+	}
+	stats.Remaining = max(stats.Booked-stats.CheckedIn, 0)
+
+	return stats, nil
+}
+
+// GetCheckInManifest lists the valid ticket codes of an event and those already checked in, sorted.
+// The caller signs the manifest.
+func GetCheckInManifest(ctx context.Context, eventID int) (*models.CheckInManifest, error) {
+	manifest := &models.CheckInManifest{EventID: eventID, GeneratedAt: time.Now().UTC().Truncate(time.Second)}
+
+	err := Db_GlobalVar.NewSelect().
+		Model((*models.Ticket)(nil)).
+		Column("code").
+		Where("event_id = ?", eventID).
+		Where("status = ?", models.TicketStatusValid).
+		Order("code").
+		Scan(ctx, &manifest.Codes)
+	if err != nil {
+		return nil, fmt.Errorf("error getting tickets of event %d: %w", eventID, err)
+	}
+
+	err = Db_GlobalVar.NewSelect().
+		TableExpr("check_in AS ci").
+		ColumnExpr("t.code").
+		Join("JOIN ticket AS t ON t.ticket_id = ci.ticket_id").
+		Where("ci.event_id = ?", eventID).
+		Where("t.status = ?", models.TicketStatusValid).
+		OrderExpr("t.code").
+		Scan(ctx, &manifest.CheckedIn)
+	if err != nil {
+		return nil, fmt.Errorf("error getting check-ins of event %d: %w", eventID, err)
+	}
+
+	if manifest.Codes == nil {
+		manifest.Codes = []string{}
+	}
+	if manifest.CheckedIn == nil {
+		manifest.CheckedIn = []string{}
+	}
+	return manifest, nil
+}
+
+// checkInClockSkew tolerates scanner clocks slightly ahead of the server
+const checkInClockSkew = 5 * time.Minute
+
+// SyncCheckIns records the check-ins a device scanned offline, oldest first so the earliest scan
+// of a ticket is kept. Scans that were not recorded as uploaded are returned as conflicts.
+func SyncCheckIns(ctx context.Context, eventID int, device, staff string, scans []models.OfflineCheckIn) (int, []models.CheckInConflict, error) {
+	scans = slices.Clone(scans)
+	slices.SortStableFunc(scans, func(a, b models.OfflineCheckIn) int { return a.ScannedAt.Compare(b.ScannedAt) })
+
+	accepted := 0
+	conflicts := []models.CheckInConflict{}
+	limit := time.Now().Add(checkInClockSkew)
+
+	for _, scan := range scans {
+		conflict := models.CheckInConflict{Code: scan.Code, ScannedAt: scan.ScannedAt}
+		if scan.ScannedAt.After(limit) {
+			conflict.Reason = models.CheckInConflictInvalidTime
+			conflicts = append(conflicts, conflict)
+			continue
+		}
+
+		var kept *models.CheckIn
+		var duplicate bool
+		err := Db_GlobalVar.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			var err error
+			kept, duplicate, err = checkInTicket(ctx, tx, new(models.Ticket), CheckInParams{
+				EventID: eventID,
+				Code:    scan.Code,
+				Gate:    strings.TrimSpace(scan.Gate),
+				Staff:   staff,
+				At:      scan.ScannedAt,
+				Source:  models.CheckInSourceOffline,
+				Device:  device,
+			})
+			return err
+		})
+
+		switch {
+		case err == nil && !duplicate:
+			accepted++
+			continue
+		case err == nil:
+			conflict.Reason = models.CheckInConflictDuplicate
+			conflict.Kept = kept
+		case errors.Is(err, ErrTicketNotFound):
+			conflict.Reason = models.CheckInConflictNotFound
+		case errors.Is(err, ErrTicketWrongEvent):
+			conflict.Reason = models.CheckInConflictWrongEvent
+		case errors.Is(err, ErrTicketVoid):
+			conflict.Reason = models.CheckInConflictVoid
+		case errors.Is(err, ErrCheckInUnavailable):
+			conflict.Reason = models.CheckInConflictUnavailable
+		default:
+			return accepted, conflicts, err
+		}
+		conflicts = append(conflicts, conflict)
+	}
+
+	return accepted, conflicts, nil
+}
@@ -2,30 +2,42 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"eventy/config"
 	"eventy/pkg/models"
+	"eventy/pkg/pricing"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/rs/zerolog/log"
-	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun"
 )
 
 // GetAllEvents retrieves all events from the database
 func GetAllEvents(ctx context.Context) ([]models.Event, error) {
 	var events []models.Event
-	err := Db_GlobalVar.NewSelect().Model(&events).Scan(ctx)
+	err := Db_GlobalVar.NewSelect().Model(&events).Apply(withEventAttendees).Scan(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("error getting all events: %w", err)
 	}
+	if err := attachTicketTypes(ctx, events); err != nil {
+		return nil, err
+	}
 	return events, nil
 }
 
 // GetEventByID retrieves a single event by its ID
 func GetEventByID(ctx context.Context, id int) (*models.Event, error) {
 	event := new(models.Event)
-	err := Db_GlobalVar.NewSelect().Model(event).Where("event_id = ?", id).Scan(ctx)
+	err := Db_GlobalVar.NewSelect().Model(event).Apply(withEventAttendees).Where("event_id = ?", id).Scan(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("error getting event by ID %d: %w", id, err)
 	}
+	if event.TicketTypes, err = GetTicketTypesByEvent(ctx, id); err != nil {
+		return nil, err
+	}
 	return event, nil
 }
 
@@ -40,8 +52,18 @@ func AddEvent(ctx context.Context, event *models.Event) error {
 	return nil
 }
 
-// UpdateEvent updates an existing event in the database
+// UpdateEvent updates an existing event in the database, the capacity cannot go below the ticket type quotas
 func UpdateEvent(ctx context.Context, id int, updates *models.Event) (int64, error) {
+	if updates.MaxCapacity > 0 {
+		total, err := quotaTotal(ctx, Db_GlobalVar, id, 0)
+		if err != nil {
+			return 0, err
+		}
+		if total > updates.MaxCapacity {
+			return 0, ErrTicketTypeQuota
+		}
+	}
+
 	res, err := Db_GlobalVar.NewUpdate().
 		Model(updates).
 		Where("event_id = ?", id).
@@ -56,85 +78,250 @@ func UpdateEvent(ctx context.Context, id int, updates *models.Event) (int64, err
 	return rowsAffected, nil
 }
 
-// UpdateEvent updates an existing event in the database
-func BookEvent(ctx context.Context, id int, userID int) (int64, error) {
-	log.Info().Msgf("Starting booking process for Event ID: %d, User ID: %d", id, userID)
+var (
+	ErrEventNotFound       = errors.New("event not found")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrEventFull           = errors.New("event is full")
+	ErrAlreadyBooked       = errors.New("user already booked for this event")
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrSeatLimit           = errors.New("too many seats for one booking")
+	ErrTooManyAttendees    = errors.New("more attendees than seats")
+)
 
-	// Fetch the current list of users for the event
-	var event models.Event
-	err := Db_GlobalVar.NewSelect().
-		Model(&event).
-		Where("event_id = ?", id).
-		Scan(ctx)
+// BookingOptions are the choices of the user when booking an event
+type BookingOptions struct {
+	TicketTypeID int // required for events with ticket types
+	PromoCode    string
+	Seats        int               // defaults to one seat, or one per attendee
+	Attendees    []models.Attendee // optional, one per ticket in order
+}
+
+// checkSeats defaults the seats of the booking and checks them against the attendees and the limit
+func (o *BookingOptions) checkSeats() error {
+	if o.Seats <= 0 {
+		o.Seats = max(len(o.Attendees), 1)
+	}
+	if limit := config.Configvar.Booking.MaxSeats; limit > 0 && o.Seats > limit {
+		return ErrSeatLimit
+	}
+	if len(o.Attendees) > o.Seats {
+		return ErrTooManyAttendees
+	}
+	return nil
+}
+
+// bookingChoices checks the ticket type and promo code of a booking inside its transaction
+func bookingChoices(ctx context.Context, tx bun.Tx, event *models.Event, userID int, opts BookingOptions) (*models.TicketType, *models.PromoCode, error) {
+	ticketType, err := selectTicketType(ctx, tx, event, opts.TicketTypeID, opts.Seats)
+	if err != nil {
+		return nil, nil, err
+	}
+	promo, err := applyPromoCode(ctx, tx, opts.PromoCode, event, userID)
 	if err != nil {
-		log.Error().Err(err).Msgf("Error fetching event with ID %d", id)
-		return 0, fmt.Errorf("error fetching event with ID %d: %w", id, err)
+		return nil, nil, err
 	}
-	log.Debug().Msgf("Fetched event: %+v", event.EventID)
+	return ticketType, promo, nil
+}
 
-	// Check if the user is already booked or if the event is full
-	for _, uid := range event.UserID {
-		if uid == userID {
-			log.Warn().Msgf("User %d is already booked for event %d", userID, id)
-			return 0, fmt.Errorf("user %d already booked for this event", userID)
-		}
+// withChoices records the ticket type and promo code on a booking
+func withChoices(booking *models.Booking, ticketType *models.TicketType, promo *models.PromoCode) {
+	if ticketType != nil {
+		booking.TicketTypeID = ticketType.TicketTypeID
+	}
+	if promo != nil {
+		booking.PromoID = promo.PromoID
+		booking.PromoCode = promo.Code
 	}
+}
 
-	log.Debug().Msgf("Event capacity: %d, Current users: %d", event.MaxCapacity, len(event.UserID))
-	if len(event.UserID) >= event.MaxCapacity {
-		log.Warn().Msgf("Event ID %d is full. Capacity: %d", id, event.MaxCapacity)
-		return 0, fmt.Errorf("event is full")
+// BookEvent books the seats of the user on the event and debits their price from the wallet.
+// Everything runs in one transaction with the event and user rows locked, so concurrent
+// bookings can neither oversell the event nor leave the booking and wallet out of sync.
+// A group booking takes all its seats or none.
+func BookEvent(ctx context.Context, id int, userID int, opts BookingOptions) (*models.Booking, error) {
+	if err := opts.checkSeats(); err != nil {
+		return nil, err
 	}
+	log.Info().Msgf("Starting booking process for Event ID: %d, User ID: %d, Seats: %d", id, userID, opts.Seats)
 
-	// Add new user ID to the event
-	event.UserID = append(event.UserID, userID)
-	log.Info().Msgf("Added User ID %d to Event ID %d", userID, id)
+	var booking *models.Booking
+	err := Db_GlobalVar.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		event, offer, err := reserveSeat(ctx, tx, id, userID, opts.Seats)
+		if err != nil {
+			return err
+		}
 
-	// Update the event with the new user list
-	res, err := Db_GlobalVar.NewUpdate().
+		// Lock the user row so the balance check and debit are atomic
+		var user models.User
+		err = tx.NewSelect().
+			Model(&user).
+			Column("user_id", "balance").
+			Where("user_id = ?", userID).
+			Where("is_guest = ?", false).
+			For("UPDATE").
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("error fetching user with ID %d: %w", userID, err)
+		}
+
+		ticketType, promo, err := bookingChoices(ctx, tx, event, userID, opts)
+		if err != nil {
+			return err
+		}
+
+		quote := pricing.Wallet(event, ticketType, promo, opts.Seats)
+		if quote.Total > 0 && !pricing.WalletAccepts(event) {
+			return ErrWalletCurrency
+		}
+		if user.Balance < quote.Total {
+			log.Warn().Msgf("User %d balance %d is below event %d price %d", userID, user.Balance, id, quote.Total)
+			return ErrInsufficientBalance
+		}
+
+		booking = &models.Booking{
+			UserID:    userID,
+			EventID:   id,
+			Seats:     opts.Seats,
+			Attendees: opts.Attendees,
+			PricePaid: quote.Total,
+			Discount:  quote.Discount,
+		}
+		withChoices(booking, ticketType, promo)
+		err = insertWalletBooking(ctx, tx, booking, fmt.Sprintf("user:%d", userID))
+		if err != nil {
+			return err
+		}
+
+		return claimOffer(ctx, tx, offer, booking.BookingID)
+	})
+	if err != nil {
+		log.Warn().Err(err).Msgf("Booking failed for User ID %d on Event ID %d", userID, id)
+		return nil, err
+	}
+
+	log.Info().Msgf("Successfully booked User ID %d for Event ID %d, Booking ID: %d", userID, id, booking.BookingID)
+	return booking, nil
+}
+
+// reserveSeat locks the event and checks the user may take the seats: the event is open, the user
+// is not booked yet, all the seats are free and nobody on the waitlist goes first. The waitlist
+// offer of the user is returned when a seat was held for them.
+func reserveSeat(ctx context.Context, tx bun.Tx, id, userID, seats int) (*models.Event, *models.WaitlistEntry, error) {
+	// Lock the event row, concurrent bookings of the same event wait here
+	var event models.Event
+	err := tx.NewSelect().
 		Model(&event).
+		Column("event_id", "category", "max_capacity", "price", "currency", "status").
 		Where("event_id = ?", id).
-		Set("user_id = ?", pgdialect.Array(event.UserID)).
-		Exec(ctx)
+		For("UPDATE").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrEventNotFound
+	}
 	if err != nil {
-		log.Error().Err(err).Msgf("Error updating event with ID %d", id)
-		return 0, fmt.Errorf("error updating event with ID %d: %w", id, err)
+		return nil, nil, fmt.Errorf("error fetching event with ID %d: %w", id, err)
+	}
+	if event.Status == models.EventStatusCancelled {
+		return nil, nil, ErrEventCancelled
+	}
+
+	// Check if the user is already booked or if the event is full
+	booked, err := hasActiveBooking(ctx, tx, id, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if booked {
+		log.Warn().Msgf("User %d is already booked for event %d", userID, id)
+		return nil, nil, ErrAlreadyBooked
 	}
-	log.Info().Msgf("Updated Event ID %d with new user list", id)
 
-	// Fetch the user
-	var user models.User
-	err = Db_GlobalVar.NewSelect().
-		Model(&user).
+	// A seat held for this user by the waitlist
+	var offer models.WaitlistEntry
+	err = tx.NewSelect().
+		Model(&offer).
+		Where("event_id = ?", id).
 		Where("user_id = ?", userID).
+		Where("status = ?", models.WaitlistStatusOffered).
+		Where("expires_at > ?", time.Now()).
+		For("UPDATE").
 		Scan(ctx)
+	hasOffer := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, fmt.Errorf("error fetching waitlist offer: %w", err)
+	}
+
+	taken, err := countActiveSeats(ctx, tx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	offers, err := countOpenOffers(ctx, tx, id, userID)
 	if err != nil {
-		log.Error().Err(err).Msgf("Error fetching user with ID %d", userID)
-		return 0, fmt.Errorf("error fetching user with ID %d: %w", userID, err)
+		return nil, nil, err
+	}
+	log.Debug().Msgf("Event capacity: %d, Taken seats: %d, Held offers: %d, Requested: %d", event.MaxCapacity, taken, offers, seats)
+	if taken+offers+seats > event.MaxCapacity {
+		log.Warn().Msgf("Event ID %d is full. Capacity: %d", id, event.MaxCapacity)
+		return nil, nil, ErrEventFull
 	}
-	log.Debug().Msgf("Fetched user: %+v", user)
 
-	// Add event ID to the user's EventID list
-	user.EventID = append(user.EventID, id)
-	log.Info().Msgf("Added Event ID %d to User ID %d", id, userID)
+	if hasOffer {
+		return &event, &offer, nil
+	}
 
-	// Update the user with the new event list
-	_, err = Db_GlobalVar.NewUpdate().
-		Model(&user).
-		Where("user_id = ?", userID).
-		//Set("user_id = ?", pgdialect.Array(event.UserID)).
-		Exec(ctx)
+	// Users on the waitlist go first
+	waiting, err := countWaiting(ctx, tx, id)
 	if err != nil {
-		log.Error().Err(err).Msgf("Error updating user with ID %d", userID)
-		return 0, fmt.Errorf("error updating user with ID %d: %w", userID, err)
+		return nil, nil, err
+	}
+	if waiting > 0 {
+		log.Warn().Msgf("Event ID %d has %d users waiting", id, waiting)
+		return nil, nil, ErrEventFull
 	}
-	log.Info().Msgf("Updated User ID %d with new event list", userID)
+	return &event, nil, nil
+}
 
-	// Log and return the result
-	rowsAffected, _ := res.RowsAffected()
-	log.Info().Msgf("Successfully booked User ID %d for Event ID %d, Rows Affected: %d", userID, id, rowsAffected)
+// claimOffer marks the waitlist offer as used by the booking
+func claimOffer(ctx context.Context, tx bun.Tx, offer *models.WaitlistEntry, bookingID int) error {
+	if offer == nil {
+		return nil
+	}
 
-	return rowsAffected, nil
+	offer.Status = models.WaitlistStatusPromoted
+	offer.BookingID = bookingID
+	if _, err := tx.NewUpdate().Model(offer).Column("status", "booking_id").WherePK().Exec(ctx); err != nil {
+		return fmt.Errorf("error updating waitlist entry %d: %w", offer.EntryID, err)
+	}
+	return nil
+}
+
+// insertWalletBooking creates a confirmed booking and debits its price from the wallet ledger.
+// The caller holds the lock on the event row.
+func insertWalletBooking(ctx context.Context, tx bun.Tx, booking *models.Booking, actor string) error {
+	booking.Status = models.BookingStatusConfirmed
+	booking.PaymentRef = models.PaymentRefWallet
+	if _, err := tx.NewInsert().Model(booking).Exec(ctx); err != nil {
+		return fmt.Errorf("error creating booking: %w", err)
+	}
+	if _, err := issueTickets(ctx, tx, booking); err != nil {
+		return err
+	}
+
+	// Free events do not touch the wallet
+	if booking.PricePaid == 0 {
+		return nil
+	}
+
+	return postWalletTransaction(ctx, tx, &models.WalletTransaction{
+		UserID:  booking.UserID,
+		Amount:  -booking.PricePaid,
+		RefType: models.WalletRefBooking,
+		RefID:   strconv.Itoa(booking.BookingID),
+		Reason:  fmt.Sprintf("Booking of event %d", booking.EventID),
+		Actor:   actor,
+	})
 }
 
 // DeleteEvent removes an event from the database by its ID
@@ -0,0 +1,268 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"eventy/config"
+	"eventy/functions"
+	"eventy/pkg/models"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+)
+
+var ErrEventCancelled = errors.New("event is cancelled")
+
+// EventDecision is the outcome of the MinCapacity check of one event
+type EventDecision struct {
+	EventID  int
+	Title    string
+	Status   string                 // confirmed or cancelled
+	Refunds  []models.Refund        // refunds of a cancelled event
+	Waitlist []models.WaitlistEntry // waitlist entries closed by the cancellation
+}
+
+// decisionWindow is how long before the start date the MinCapacity is checked
+func decisionWindow() time.Duration {
+	hours := config.Configvar.Booking.DecisionHours
+	if hours < 0 {
+		hours = 0
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// EventDecisionAt returns when the event is confirmed or cancelled
+func EventDecisionAt(startDate string) (time.Time, error) {
+	start, err := functions.ParseEventDate(startDate)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return start.Add(-decisionWindow()), nil
+}
+
+// withBookedSeats selects the number of seats of the active bookings of the event as "booked"
+func withBookedSeats(q *bun.SelectQuery) *bun.SelectQuery {
+	return q.ColumnExpr(`(SELECT COALESCE(SUM(b.seats), 0) FROM booking AS b WHERE b.event_id = ?TableAlias.event_id AND b.status IN (?)) AS booked`,
+		bun.In(models.BookingActiveStatuses))
+}
+
+// GetEventsAtRisk lists the undecided events still below MinCapacity, the closest decision first
+func GetEventsAtRisk(ctx context.Context) ([]models.EventAtRisk, error) {
+	var events []models.EventAtRisk
+	err := Db_GlobalVar.NewSelect().
+		Model((*models.Event)(nil)).
+		Column("event_id", "title", "start_date", "min_capacity", "max_capacity").
+		Apply(withBookedSeats).
+		Where("?TableAlias.status = ?", models.EventStatusScheduled).
+		Where(`(SELECT COALESCE(SUM(b.seats), 0) FROM booking AS b WHERE b.event_id = ?TableAlias.event_id AND b.status IN (?)) < ?TableAlias.min_capacity`,
+			bun.In(models.BookingActiveStatuses)).
+		Scan(ctx, &events)
+	if err != nil {
+		return nil, fmt.Errorf("error getting events at risk: %w", err)
+	}
+
+	for i := range events {
+		events[i].Missing = events[i].MinCapacity - events[i].Booked
+		decisionAt, err := EventDecisionAt(events[i].StartDate)
+		if err != nil {
+			log.Warn().Err(err).Int("EventID", events[i].EventID).Msg("Invalid event start date")
+			continue
+		}
+		events[i].DecisionAt = decisionAt
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].DecisionAt.Before(events[j].DecisionAt)
+	})
+	return events, nil
+}
+
+// DecideEvents confirms or cancels every undecided event whose decision deadline has passed.
+// Events already started are left alone, attendees are never refunded for an event that took place.
+// A failing event is logged and the others are still decided.
+func DecideEvents(ctx context.Context, now time.Time) ([]EventDecision, error) {
+	var events []models.Event
+	err := Db_GlobalVar.NewSelect().
+		Model(&events).
+		Column("event_id", "start_date").
+		Where("status = ?", models.EventStatusScheduled).
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting undecided events: %w", err)
+	}
+
+	var decisions []EventDecision
+	var errs []error
+	for _, event := range events {
+		start, err := functions.ParseEventDate(event.StartDate)
+		if err != nil {
+			log.Warn().Err(err).Int("EventID", event.EventID).Msg("Invalid event start date, cannot decide event")
+			continue
+		}
+		if now.Before(start.Add(-decisionWindow())) || !now.Before(start) {
+			continue
+		}
+
+		decision, err := decideEvent(ctx, event.EventID, now)
+		if err != nil {
+			log.Err(err).Int("EventID", event.EventID).Msg("Error deciding event")
+			errs = append(errs, err)
+			continue
+		}
+		if decision != nil {
+			decisions = append(decisions, *decision)
+		}
+	}
+
+	return decisions, errors.Join(errs...)
+}
+
+// closePastEvents marks the undecided events already started as confirmed, they took place
+// before the MinCapacity decision existed and must not be cancelled afterwards
+func closePastEvents(ctx context.Context, now time.Time) (int, error) {
+	var events []models.Event
+	err := Db_GlobalVar.NewSelect().
+		Model(&events).
+		Column("event_id", "start_date").
+		Where("status = ?", models.EventStatusScheduled).
+		Scan(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error getting undecided events: %w", err)
+	}
+
+	var ids []int
+	for _, event := range events {
+		start, err := functions.ParseEventDate(event.StartDate)
+		if err == nil && !now.Before(start) {
+			ids = append(ids, event.EventID)
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	_, err = Db_GlobalVar.NewUpdate().
+		Model((*models.Event)(nil)).
+		Set("status = ?", models.EventStatusConfirmed).
+		Set("decided_at = ?", now).
+		Where("event_id IN (?)", bun.In(ids)).
+		Where("status = ?", models.EventStatusScheduled).
+		Exec(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error closing past events: %w", err)
+	}
+	return len(ids), nil
+}
+
+// decideEvent confirms the event if MinCapacity is reached, otherwise cancels it and refunds every attendee
+func decideEvent(ctx context.Context, eventID int, now time.Time) (*EventDecision, error) {
+	var decision *EventDecision
+
+	err := Db_GlobalVar.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var event models.Event
+		err := tx.NewSelect().
+			Model(&event).
+			Column("event_id", "title", "min_capacity", "status").
+			Where("event_id = ?", eventID).
+			For("UPDATE").
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error fetching event with ID %d: %w", eventID, err)
+		}
+		// Decided meanwhile
+		if event.Status != models.EventStatusScheduled {
+			return nil
+		}
+
+		// Only paid bookings count towards MinCapacity
+		var seats int
+		err = tx.NewSelect().
+			Model((*models.Booking)(nil)).
+			ColumnExpr("COALESCE(SUM(seats), 0)").
+			Where("event_id = ?", eventID).
+			Where("status IN (?)", bun.In(models.BookingActiveStatuses)).
+			Scan(ctx, &seats)
+		if err != nil {
+			return fmt.Errorf("error counting bookings of event with ID %d: %w", eventID, err)
+		}
+
+		decision = &EventDecision{EventID: eventID, Title: event.Title, Status: models.EventStatusConfirmed}
+		if seats < event.MinCapacity {
+			decision.Status = models.EventStatusCancelled
+
+			var bookingIDs []int
+			err = tx.NewSelect().
+				Model((*models.Booking)(nil)).
+				Column("booking_id").
+				Where("event_id = ?", eventID).
+				Where("status IN (?)", bun.In(models.BookingActiveStatuses)).
+				Order("booking_id").
+				Scan(ctx, &bookingIDs)
+			if err != nil {
+				return fmt.Errorf("error getting bookings of event with ID %d: %w", eventID, err)
+			}
+
+			for _, bookingID := range bookingIDs {
+				_, refund, err := cancelBooking(ctx, tx, CancelBookingParams{
+					BookingID:  bookingID,
+					Actor:      "system",
+					Reason:     fmt.Sprintf("Event cancelled: %d of %d minimum bookings", seats, event.MinCapacity),
+					FullRefund: true,
+				})
+				if err != nil {
+					return err
+				}
+				decision.Refunds = append(decision.Refunds, *refund)
+			}
+
+			// Seats still waiting for a card payment are released
+			_, err = tx.NewUpdate().
+				Model((*models.Booking)(nil)).
+				Set("status = ?", models.BookingStatusCancelled).
+				Set("cancelled_at = ?", now).
+				Where("event_id = ?", eventID).
+				Where("status = ?", models.BookingStatusPending).
+				Exec(ctx)
+			if err != nil {
+				return fmt.Errorf("error releasing pending bookings of event with ID %d: %w", eventID, err)
+			}
+
+			_, err = tx.NewUpdate().
+				Model(&decision.Waitlist).
+				Set("status = ?", models.WaitlistStatusExpired).
+				Where("event_id = ?", eventID).
+				Where("status IN (?)", bun.In(waitlistOpenStatuses)).
+				Returning("*").
+				Exec(ctx)
+			if err != nil {
+				return fmt.Errorf("error closing waitlist of event with ID %d: %w", eventID, err)
+			}
+		}
+
+		_, err = tx.NewUpdate().
+			Model((*models.Event)(nil)).
+			Set("status = ?", decision.Status).
+			Set("decided_at = ?", now).
+			Where("event_id = ?", eventID).
+			Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("error updating status of event with ID %d: %w", eventID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if decision != nil {
+		log.Info().Msgf("Event %d is %s (%d refunds)", eventID, decision.Status, len(decision.Refunds))
+	}
+	return decision, nil
+}
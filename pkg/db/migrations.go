@@ -0,0 +1,167 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// migrations holds idempotent statements for changes CreateTables cannot apply to existing tables
+var migrations = []string{
+	`ALTER TABLE "user" ADD COLUMN IF NOT EXISTS "email_verified" BOOLEAN NOT NULL DEFAULT FALSE`,
+
+	`ALTER TABLE event ADD COLUMN IF NOT EXISTS refund_full_days BIGINT NOT NULL DEFAULT 0`,
+	`ALTER TABLE event ADD COLUMN IF NOT EXISTS refund_partial_percent BIGINT NOT NULL DEFAULT 0`,
+
+	// Bookings: user_id must be unique to be referenced by the booking table
+	`DO $$ BEGIN
+		IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'user_user_id_key') THEN
+			ALTER TABLE "user" ADD CONSTRAINT user_user_id_key UNIQUE (user_id);
+		END IF;
+	END $$`,
+	`DO $$ BEGIN
+		IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'booking_user_id_fkey') THEN
+			ALTER TABLE booking ADD CONSTRAINT booking_user_id_fkey
+				FOREIGN KEY (user_id) REFERENCES "user" (user_id) ON DELETE CASCADE;
+		END IF;
+		IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'booking_event_id_fkey') THEN
+			ALTER TABLE booking ADD CONSTRAINT booking_event_id_fkey
+				FOREIGN KEY (event_id) REFERENCES event (event_id) ON DELETE CASCADE;
+		END IF;
+	END $$`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS booking_active_user_event_idx
+		ON booking (user_id, event_id) WHERE status <> 'cancelled'`,
+	`CREATE INDEX IF NOT EXISTS booking_event_id_idx ON booking (event_id)`,
+
+	// Bookings: convert the legacy event.user_id / user.event_id arrays, then drop them
+	`DO $$ BEGIN
+		IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'event' AND column_name = 'user_id') THEN
+			INSERT INTO booking (user_id, event_id, status, price_paid, payment_ref)
+			SELECT DISTINCT a.uid, e.event_id, 'confirmed', COALESCE(e.price, 0), 'legacy'
+			FROM event AS e
+			CROSS JOIN LATERAL unnest(e.user_id) AS a(uid)
+			WHERE EXISTS (SELECT 1 FROM "user" AS u WHERE u.user_id = a.uid)
+			AND NOT EXISTS (SELECT 1 FROM booking AS b WHERE b.user_id = a.uid AND b.event_id = e.event_id);
+
+			ALTER TABLE event DROP COLUMN user_id;
+		END IF;
+
+		IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'user' AND column_name = 'event_id') THEN
+			INSERT INTO booking (user_id, event_id, status, price_paid, payment_ref)
+			SELECT DISTINCT u.user_id, e.event_id, 'confirmed', COALESCE(e.price, 0), 'legacy'
+			FROM "user" AS u
+			CROSS JOIN LATERAL jsonb_array_elements_text(
+				CASE WHEN jsonb_typeof(to_jsonb(u.event_id)) = 'array' THEN to_jsonb(u.event_id) ELSE '[]'::jsonb END
+			) AS a(eid)
+			JOIN event AS e ON e.event_id = a.eid::bigint
+			WHERE NOT EXISTS (SELECT 1 FROM booking AS b WHERE b.user_id = u.user_id AND b.event_id = e.event_id);
+
+			ALTER TABLE "user" DROP COLUMN event_id;
+		END IF;
+
+		ALTER TABLE "user" DROP COLUMN IF EXISTS booked_events;
+	END $$`,
+
+	// Waitlist: one open entry per user and event
+	`CREATE UNIQUE INDEX IF NOT EXISTS waitlist_open_user_event_idx
+		ON waitlist (event_id, user_id) WHERE status IN ('waiting', 'offered')`,
+	`CREATE INDEX IF NOT EXISTS waitlist_event_status_idx ON waitlist (event_id, status, entry_id)`,
+
+	// Events: MinCapacity decision
+	`ALTER TABLE event ADD COLUMN IF NOT EXISTS status VARCHAR NOT NULL DEFAULT 'scheduled'`,
+	`ALTER TABLE event ADD COLUMN IF NOT EXISTS decided_at TIMESTAMPTZ`,
+
+	// Wallet ledger: open it with the balances held so far, then forbid overdrafts
+	`UPDATE "user" SET balance = 0 WHERE balance IS NULL`,
+	`ALTER TABLE "user" ALTER COLUMN balance SET DEFAULT 0`,
+	`ALTER TABLE "user" ALTER COLUMN balance SET NOT NULL`,
+	`INSERT INTO wallet_transaction (user_id, amount, balance_after, ref_type, reason, actor)
+		SELECT u.user_id, u.balance, u.balance, 'opening', 'Balance before the wallet ledger', 'system'
+		FROM "user" AS u
+		WHERE u.balance <> 0
+		AND NOT EXISTS (SELECT 1 FROM wallet_transaction AS w WHERE w.user_id = u.user_id)`,
+	`DO $$ BEGIN
+		IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'user_balance_non_negative') THEN
+			ALTER TABLE "user" ADD CONSTRAINT user_balance_non_negative CHECK (balance >= 0) NOT VALID;
+		END IF;
+	END $$`,
+	`CREATE INDEX IF NOT EXISTS wallet_transaction_user_id_idx ON wallet_transaction (user_id, tx_id)`,
+
+	// Payments
+	`CREATE INDEX IF NOT EXISTS payment_booking_id_idx ON payment (booking_id)`,
+	`CREATE INDEX IF NOT EXISTS booking_pending_idx ON booking (created_at) WHERE status = 'pending'`,
+	`ALTER TABLE event ADD COLUMN IF NOT EXISTS currency VARCHAR`,
+
+	// Refunds through the original payment method
+	`ALTER TABLE refund ADD COLUMN IF NOT EXISTS status VARCHAR NOT NULL DEFAULT 'succeeded'`,
+	`ALTER TABLE refund ADD COLUMN IF NOT EXISTS payment_id BIGINT`,
+	`ALTER TABLE refund ADD COLUMN IF NOT EXISTS provider_ref VARCHAR`,
+	`ALTER TABLE refund ADD COLUMN IF NOT EXISTS failure_reason VARCHAR`,
+	`CREATE INDEX IF NOT EXISTS refund_pending_idx ON refund (refund_id) WHERE status = 'pending'`,
+	`ALTER TABLE refund ADD COLUMN IF NOT EXISTS attempts BIGINT NOT NULL DEFAULT 0`,
+
+	// Promo codes
+	`ALTER TABLE booking ADD COLUMN IF NOT EXISTS promo_id BIGINT`,
+	`ALTER TABLE booking ADD COLUMN IF NOT EXISTS promo_code VARCHAR`,
+	`ALTER TABLE booking ADD COLUMN IF NOT EXISTS discount BIGINT NOT NULL DEFAULT 0`,
+	`CREATE INDEX IF NOT EXISTS booking_promo_id_idx ON booking (promo_id, user_id)`,
+
+	// Tickets: one per confirmed booking, issued for the bookings made before tickets existed
+	`CREATE INDEX IF NOT EXISTS ticket_booking_id_idx ON ticket (booking_id)`,
+	`CREATE INDEX IF NOT EXISTS ticket_user_id_idx ON ticket (user_id)`,
+	`INSERT INTO ticket (booking_id, event_id, user_id, code, status)
+		SELECT b.booking_id, b.event_id, b.user_id, upper(substr(md5(random()::text || b.booking_id::text), 1, 16)), 'valid'
+		FROM booking b
+		WHERE b.status = 'confirmed' AND NOT EXISTS (SELECT 1 FROM ticket t WHERE t.booking_id = b.booking_id)`,
+	`CREATE INDEX IF NOT EXISTS check_in_event_id_idx ON check_in (event_id, gate)`,
+	`ALTER TABLE check_in ADD COLUMN IF NOT EXISTS source VARCHAR NOT NULL DEFAULT 'online'`,
+	`ALTER TABLE check_in ADD COLUMN IF NOT EXISTS device_id VARCHAR`,
+
+	// Ticket types
+	`ALTER TABLE booking ADD COLUMN IF NOT EXISTS ticket_type_id BIGINT`,
+	`CREATE INDEX IF NOT EXISTS booking_ticket_type_id_idx ON booking (ticket_type_id) WHERE ticket_type_id IS NOT NULL`,
+	`CREATE INDEX IF NOT EXISTS ticket_type_event_id_idx ON ticket_type (event_id)`,
+
+	// Group bookings: one booking holds several seats, each with its own ticket
+	`ALTER TABLE booking ADD COLUMN IF NOT EXISTS seats BIGINT NOT NULL DEFAULT 1`,
+	`ALTER TABLE booking ADD COLUMN IF NOT EXISTS attendees JSONB`,
+	`ALTER TABLE ticket ADD COLUMN IF NOT EXISTS attendee_name VARCHAR`,
+	`ALTER TABLE ticket ADD COLUMN IF NOT EXISTS attendee_email VARCHAR`,
+
+	// Operators: tokens carry the version they were issued for, a change to the operator revokes them
+	`ALTER TABLE operator ADD COLUMN IF NOT EXISTS token_version BIGINT NOT NULL DEFAULT 0`,
+}
+
+// Migrate runs every migration statement, it is safe to call on each startup.
+// A failing statement is logged and the following ones still run.
+func Migrate(ctx context.Context) error {
+	if Db_GlobalVar == nil {
+		return fmt.Errorf("db connection is nil")
+	}
+
+	var errs []error
+	for _, stmt := range migrations {
+		if _, err := Db_GlobalVar.ExecContext(ctx, stmt); err != nil {
+			log.Err(err).Str("Statement", stmt).Msg("Migration statement failed")
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d migration statements failed: %w", len(errs), len(migrations), errors.Join(errs...))
+	}
+
+	// Events that already took place are decided, the scheduler only decides upcoming ones
+	closed, err := closePastEvents(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	if closed > 0 {
+		log.Info().Msgf("Marked %d past events as decided", closed)
+	}
+
+	log.Debug().Msgf("Applied %d migration statements", len(migrations))
+	return nil
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"eventy/pkg/models"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+// GetAllOperators retrieves all back-office operators from the database
+func GetAllOperators(ctx context.Context) ([]models.Operator, error) {
+	var operators []models.Operator
+	err := Db_GlobalVar.NewSelect().Model(&operators).Order("operator_id").Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting all operators: %w", err)
+	}
+	return operators, nil
+}
+
+// GetOperatorByID retrieves a single operator by its ID
+func GetOperatorByID(ctx context.Context, id int) (*models.Operator, error) {
+	operator := new(models.Operator)
+	err := Db_GlobalVar.NewSelect().Model(operator).Where("operator_id = ?", id).Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting operator by ID %d: %w", id, err)
+	}
+	return operator, nil
+}
+
+// GetOperatorByUsername retrieves a single operator by its username
+func GetOperatorByUsername(ctx context.Context, username string) (*models.Operator, error) {
+	operator := new(models.Operator)
+	err := Db_GlobalVar.NewSelect().Model(operator).Where("username = ?", username).Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting operator by username %s: %w", username, err)
+	}
+	return operator, nil
+}
+
+// AddOperator creates a new operator in the database
+func AddOperator(ctx context.Context, operator *models.Operator) error {
+	_, err := Db_GlobalVar.NewInsert().Model(operator).Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("error creating operator: %w", err)
+	}
+	log.Debug().Msgf("New operator added with ID: %d", operator.OperatorID)
+	return nil
+}
+
+// UpdateOperator updates the given columns of an existing operator.
+// The token version is bumped, so the tokens issued before the change are no longer accepted.
+func UpdateOperator(ctx context.Context, id int, updates *models.Operator, columns []string) (int64, error) {
+	res, err := Db_GlobalVar.NewUpdate().
+		Model(updates).
+		Column(append(columns, "token_version")...).
+		Value("token_version", "token_version + 1").
+		Where("operator_id = ?", id).
+		Exec(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error updating operator with ID %d: %w", id, err)
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	log.Debug().Msgf("Updated operator with ID: %d, rows affected: %d", id, rowsAffected)
+	return rowsAffected, nil
+}
+
+// DeleteOperator removes an operator from the database by its ID
+func DeleteOperator(ctx context.Context, id int) (int64, error) {
+	res, err := Db_GlobalVar.NewDelete().Model(&models.Operator{}).Where("operator_id = ?", id).Exec(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting operator with ID %d: %w", id, err)
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	log.Debug().Msgf("Deleted operator with ID: %d, rows affected: %d", id, rowsAffected)
+	return rowsAffected, nil
+}
@@ -0,0 +1,533 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"eventy/config"
+	"eventy/pkg/models"
+	"eventy/pkg/pricing"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+)
+
+var (
+	ErrPaymentNotFound = errors.New("payment not found")
+	ErrNothingToPay    = errors.New("event is free, book it without a payment")
+)
+
+// PaymentEventResult is what a provider event changed
+type PaymentEventResult struct {
+	Payment    *models.Payment
+	Booking    *models.Booking        // booking of the payment, confirmed, released or refunded by the event
+	Refund     *models.Refund         // refund recorded for a booking, pending when it must be sent to the provider
+	Promotions []models.WaitlistEntry // waitlist entries that received a released seat
+}
+
+// paymentPendingWindow is how long a pending booking waits for its payment
+func paymentPendingWindow() time.Duration {
+	minutes := config.Configvar.Payment.PendingMinutes
+	if minutes <= 0 {
+		minutes = 30
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// CreatePendingBooking holds the seats of the user until the card payment of the booking succeeds.
+// The price is computed from the locked event row, so it is the amount the payment must charge.
+func CreatePendingBooking(ctx context.Context, eventID, userID int, opts BookingOptions) (*models.Booking, *pricing.Quote, error) {
+	if err := opts.checkSeats(); err != nil {
+		return nil, nil, err
+	}
+
+	var booking *models.Booking
+	var quote pricing.Quote
+
+	err := Db_GlobalVar.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		event, offer, err := reserveSeat(ctx, tx, eventID, userID, opts.Seats)
+		if err != nil {
+			return err
+		}
+
+		ticketType, promo, err := bookingChoices(ctx, tx, event, userID, opts)
+		if err != nil {
+			return err
+		}
+
+		quote = pricing.Card(event, ticketType, promo, opts.Seats)
+		if quote.Total <= 0 {
+			return ErrNothingToPay
+		}
+
+		booking = &models.Booking{
+			UserID:    userID,
+			EventID:   eventID,
+			Status:    models.BookingStatusPending,
+			Seats:     opts.Seats,
+			Attendees: opts.Attendees,
+			PricePaid: quote.Total,
+			Discount:  quote.Discount,
+		}
+		withChoices(booking, ticketType, promo)
+		if _, err := tx.NewInsert().Model(booking).Exec(ctx); err != nil {
+			return fmt.Errorf("error creating booking: %w", err)
+		}
+
+		return claimOffer(ctx, tx, offer, booking.BookingID)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	log.Info().Msgf("Pending booking %d of User ID %d for Event ID %d, total %d %s", booking.BookingID, userID, eventID, quote.Total, quote.Currency)
+	return booking, &quote, nil
+}
+
+// ReleasePendingBooking cancels a booking still waiting for its payment and hands the seat to the waitlist
+func ReleasePendingBooking(ctx context.Context, bookingID int) ([]models.WaitlistEntry, error) {
+	var promotions []models.WaitlistEntry
+	err := Db_GlobalVar.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		booking, err := releasePendingBooking(ctx, tx, bookingID)
+		if err != nil || booking == nil {
+			return err
+		}
+		promotions, err = promoteWaitlist(ctx, tx, booking.EventID)
+		return err
+	})
+	return promotions, err
+}
+
+// releasePendingBooking cancels the booking if it is still pending, it returns nil otherwise
+func releasePendingBooking(ctx context.Context, tx bun.Tx, bookingID int) (*models.Booking, error) {
+	var booking models.Booking
+	now := time.Now()
+	res, err := tx.NewUpdate().
+		Model(&booking).
+		Set("status = ?", models.BookingStatusCancelled).
+		Set("cancelled_at = ?", now).
+		Where("booking_id = ?", bookingID).
+		Where("status = ?", models.BookingStatusPending).
+		Returning("*").
+		Exec(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error releasing booking with ID %d: %w", bookingID, err)
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return nil, nil
+	}
+	return &booking, nil
+}
+
+// ExpirePendingBookings releases the pending bookings whose payment did not succeed in time
+func ExpirePendingBookings(ctx context.Context) ([]models.WaitlistEntry, error) {
+	var bookingIDs []int
+	err := Db_GlobalVar.NewSelect().
+		Model((*models.Booking)(nil)).
+		Column("booking_id").
+		Where("status = ?", models.BookingStatusPending).
+		Where("created_at <= ?", time.Now().Add(-paymentPendingWindow())).
+		Scan(ctx, &bookingIDs)
+	if err != nil {
+		return nil, fmt.Errorf("error getting expired pending bookings: %w", err)
+	}
+
+	var promotions []models.WaitlistEntry
+	for _, id := range bookingIDs {
+		promoted, err := ReleasePendingBooking(ctx, id)
+		if err != nil {
+			return promotions, err
+		}
+		log.Info().Msgf("Pending booking %d expired", id)
+		promotions = append(promotions, promoted...)
+	}
+	return promotions, nil
+}
+
+// AddPayment records a payment created with the provider
+func AddPayment(ctx context.Context, payment *models.Payment) error {
+	if payment.Status == "" {
+		payment.Status = models.PaymentStatusPending
+	}
+	if _, err := Db_GlobalVar.NewInsert().Model(payment).Exec(ctx); err != nil {
+		return fmt.Errorf("error creating payment: %w", err)
+	}
+	return nil
+}
+
+// GetPayments retrieves payments, optionally filtered by booking or user
+func GetPayments(ctx context.Context, bookingID, userID int) ([]models.Payment, error) {
+	var payments []models.Payment
+	q := Db_GlobalVar.NewSelect().Model(&payments).Order("payment_id DESC")
+	if bookingID != 0 {
+		q = q.Where("booking_id = ?", bookingID)
+	}
+	if userID != 0 {
+		q = q.Where("user_id = ?", userID)
+	}
+
+	if err := q.Scan(ctx); err != nil {
+		return nil, fmt.Errorf("error getting payments: %w", err)
+	}
+	return payments, nil
+}
+
+// HandlePaymentEvent applies a verified provider event to its payment.
+// Each provider event ID is processed once, a replay returns duplicate=true and changes nothing.
+func HandlePaymentEvent(ctx context.Context, provider string, event models.PaymentEvent) (result *PaymentEventResult, duplicate bool, err error) {
+	err = Db_GlobalVar.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.NewInsert().
+			Model(&models.WebhookEvent{
+				EventID:     event.ID,
+				Provider:    provider,
+				Type:        event.Type,
+				ProviderRef: event.ProviderRef,
+			}).
+			On("CONFLICT (event_id) DO NOTHING").
+			Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("error recording webhook event %s: %w", event.ID, err)
+		}
+		if rows, _ := res.RowsAffected(); rows == 0 {
+			duplicate = true
+			return nil
+		}
+
+		// Read without a lock first: the event and the booking are locked before the payment
+		var payment models.Payment
+		err = tx.NewSelect().
+			Model(&payment).
+			Where("provider = ?", provider).
+			Where("provider_ref = ?", event.ProviderRef).
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Not created by us, keep the event record so it is not processed again
+			log.Warn().Str("Event", event.ID).Str("Ref", event.ProviderRef).Msg("Webhook event for an unknown payment")
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error fetching payment %s: %w", event.ProviderRef, err)
+		}
+
+		var booking *models.Booking
+		if payment.Purpose == models.PaymentPurposeBooking {
+			if booking, err = lockBooking(ctx, tx, payment.BookingID); err != nil {
+				return err
+			}
+		}
+		err = tx.NewSelect().Model(&payment).WherePK().For("UPDATE").Scan(ctx)
+		if err != nil {
+			return fmt.Errorf("error fetching payment %s: %w", event.ProviderRef, err)
+		}
+
+		result = &PaymentEventResult{Payment: &payment, Booking: booking}
+		switch event.Kind {
+		case models.PaymentEventSucceeded:
+			return paymentSucceeded(ctx, tx, &payment, booking, event, result)
+		case models.PaymentEventFailed:
+			return paymentFailed(ctx, tx, &payment, event, result)
+		case models.PaymentEventRefunded:
+			return paymentRefunded(ctx, tx, &payment, booking, event, result)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return result, duplicate, nil
+}
+
+// paymentSucceeded confirms the pending booking or credits the wallet top-up.
+// The booking of a booking payment is locked by the caller, with its event.
+func paymentSucceeded(ctx context.Context, tx bun.Tx, payment *models.Payment, booking *models.Booking, event models.PaymentEvent, result *PaymentEventResult) error {
+	if payment.Status != models.PaymentStatusPending && payment.Status != models.PaymentStatusFailed {
+		return nil
+	}
+
+	now := time.Now()
+	payment.Status = models.PaymentStatusSucceeded
+	payment.FailureReason = ""
+	payment.CompletedAt = &now
+	_, err := tx.NewUpdate().Model(payment).Column("status", "failure_reason", "completed_at").WherePK().Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("error updating payment %d: %w", payment.PaymentID, err)
+	}
+
+	switch payment.Purpose {
+	case models.PaymentPurposeTopup:
+		// The wallet is only credited with the exact amount the top-up was created for
+		if !paymentMatches(payment, event) {
+			log.Error().Msgf("Payment %s received %d %s for a top-up of %d %s, the wallet is not credited and a refund is needed",
+				payment.ProviderRef, event.Amount, event.Currency, payment.Amount, payment.Currency)
+			return flagPayment(ctx, tx, payment, fmt.Sprintf("received %d %s, expected %d %s", event.Amount, event.Currency, payment.Amount, payment.Currency))
+		}
+		return postWalletTransaction(ctx, tx, &models.WalletTransaction{
+			UserID:  payment.UserID,
+			Amount:  payment.Amount,
+			RefType: models.WalletRefPayment,
+			RefID:   payment.ProviderRef,
+			Reason:  "Wallet top-up",
+			Actor:   "system",
+		})
+
+	case models.PaymentPurposeBooking:
+		// The seat is only confirmed for the exact price of the booking
+		if !paymentMatches(payment, event) || payment.Amount != booking.PricePaid {
+			log.Error().Msgf("Payment %s received %d %s for booking %d priced %d %s, a refund is needed",
+				payment.ProviderRef, event.Amount, event.Currency, booking.BookingID, booking.PricePaid, payment.Currency)
+			if _, err := releasePendingBooking(ctx, tx, booking.BookingID); err != nil {
+				return err
+			}
+			if result.Refund, err = refundUnkeptPayment(ctx, tx, payment, booking, event.Amount); err != nil {
+				return err
+			}
+			result.Promotions, err = promoteWaitlist(ctx, tx, booking.EventID)
+			return err
+		}
+
+		if booking.Status == models.BookingStatusCancelled {
+			// The seats were released before the payment went through, keep them only if all still free
+			// and their ticket type and promo code still allow the booking, as when it was made
+			if err := rebook(ctx, tx, booking); err != nil {
+				if !seatLost(err) {
+					return err
+				}
+				log.Error().Msgf("Payment %s succeeded for released booking %d: %v, a refund is needed", payment.ProviderRef, booking.BookingID, err)
+				result.Refund, err = refundUnkeptPayment(ctx, tx, payment, booking, event.Amount)
+				return err
+			}
+			booking.CancelledAt = nil
+		}
+
+		booking.Status = models.BookingStatusConfirmed
+		booking.PaymentRef = payment.ProviderRef
+		_, err = tx.NewUpdate().Model(booking).Column("status", "payment_ref", "cancelled_at").WherePK().Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("error confirming booking with ID %d: %w", booking.BookingID, err)
+		}
+		if _, err := issueTickets(ctx, tx, booking); err != nil {
+			return err
+		}
+		log.Info().Msgf("Booking %d confirmed by payment %s", booking.BookingID, payment.ProviderRef)
+	}
+	return nil
+}
+
+// rebook checks a released booking can take its seats again inside the payment transaction,
+// with the same checks as a new booking
+func rebook(ctx context.Context, tx bun.Tx, booking *models.Booking) error {
+	event, _, err := reserveSeat(ctx, tx, booking.EventID, booking.UserID, booking.Seats)
+	if err != nil {
+		return err
+	}
+	_, _, err = bookingChoices(ctx, tx, event, booking.UserID, BookingOptions{
+		TicketTypeID: booking.TicketTypeID,
+		PromoCode:    booking.PromoCode,
+		Seats:        booking.Seats,
+	})
+	return err
+}
+
+// seatLost reports whether the error of rebook means the seats cannot be kept
+func seatLost(err error) bool {
+	for _, target := range []error{
+		ErrEventFull, ErrAlreadyBooked, ErrEventCancelled,
+		ErrTicketTypeNotFound, ErrTicketTypeRequired, ErrTicketTypeNotOnSale, ErrTicketTypeSoldOut,
+		ErrPromoNotFound, ErrPromoNotApplicable, ErrPromoExhausted, ErrPromoUserLimit,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// paymentMatches reports whether the provider received the amount and currency the payment was created for
+func paymentMatches(payment *models.Payment, event models.PaymentEvent) bool {
+	return event.Amount == payment.Amount && strings.EqualFold(event.Currency, payment.Currency)
+}
+
+// flagPayment records why a succeeded payment was not applied, for the back-office to settle by hand
+func flagPayment(ctx context.Context, tx bun.Tx, payment *models.Payment, reason string) error {
+	payment.FailureReason = reason
+	if _, err := tx.NewUpdate().Model(payment).Column("failure_reason").WherePK().Exec(ctx); err != nil {
+		return fmt.Errorf("error flagging payment %d: %w", payment.PaymentID, err)
+	}
+	return nil
+}
+
+// paymentFailed records the failure and releases the seat of the pending booking.
+// The user may retry the same payment, a later success takes the seat back if it is still free.
+func paymentFailed(ctx context.Context, tx bun.Tx, payment *models.Payment, event models.PaymentEvent, result *PaymentEventResult) error {
+	if payment.Status != models.PaymentStatusPending {
+		return nil
+	}
+
+	payment.Status = models.PaymentStatusFailed
+	payment.FailureReason = event.FailureReason
+	_, err := tx.NewUpdate().Model(payment).Column("status", "failure_reason").WherePK().Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("error updating payment %d: %w", payment.PaymentID, err)
+	}
+
+	if payment.Purpose != models.PaymentPurposeBooking {
+		return nil
+	}
+
+	booking, err := releasePendingBooking(ctx, tx, payment.BookingID)
+	if err != nil || booking == nil {
+		return err
+	}
+	result.Booking = booking
+	result.Promotions, err = promoteWaitlist(ctx, tx, booking.EventID)
+	return err
+}
+
+// paymentRefunded records a refund made with the provider, from its dashboard or by us.
+// The booking of a booking payment is locked by the caller, with its event.
+func paymentRefunded(ctx context.Context, tx bun.Tx, payment *models.Payment, booking *models.Booking, event models.PaymentEvent, result *PaymentEventResult) error {
+	// The provider answer to a refund we sent may have recorded it already, leaving nothing new here
+	delta := event.AmountRefunded - payment.AmountRefunded
+	if delta > 0 {
+		payment.AmountRefunded = event.AmountRefunded
+		payment.Status = models.PaymentStatusPartiallyRefunded
+		if payment.AmountRefunded >= payment.Amount {
+			payment.Status = models.PaymentStatusRefunded
+		}
+		_, err := tx.NewUpdate().Model(payment).Column("status", "amount_refunded").WherePK().Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("error updating payment %d: %w", payment.PaymentID, err)
+		}
+	}
+
+	switch payment.Purpose {
+	case models.PaymentPurposeTopup:
+		if delta <= 0 {
+			return nil
+		}
+		// Take the refunded credit back from the wallet
+		err := postWalletTransaction(ctx, tx, &models.WalletTransaction{
+			UserID:  payment.UserID,
+			Amount:  -delta,
+			RefType: models.WalletRefPayment,
+			RefID:   payment.ProviderRef,
+			Reason:  "Top-up refunded",
+			Actor:   "system",
+		})
+		if errors.Is(err, ErrInsufficientBalance) {
+			log.Error().Msgf("Top-up %s refunded but the wallet of user %d cannot cover %d", payment.ProviderRef, payment.UserID, delta)
+			return nil
+		}
+		return err
+
+	case models.PaymentPurposeBooking:
+		if delta > 0 {
+			// Refunds sent from here settle first, only the rest was made outside the application
+			rest, err := settlePendingRefunds(ctx, tx, payment.PaymentID, delta)
+			if err != nil {
+				return err
+			}
+			if rest > 0 {
+				refund := models.Refund{
+					BookingID: booking.BookingID,
+					UserID:    booking.UserID,
+					EventID:   booking.EventID,
+					Amount:    rest,
+					Percent:   rest * 100 / max(payment.Amount, 1),
+					Method:    models.RefundMethodCard,
+					Status:    models.RefundStatusSucceeded,
+					PaymentID: payment.PaymentID,
+					Reason:    "Refunded with the payment provider",
+					Actor:     "system",
+				}
+				if _, err := tx.NewInsert().Model(&refund).Exec(ctx); err != nil {
+					return fmt.Errorf("error recording refund of booking %d: %w", booking.BookingID, err)
+				}
+				result.Refund = &refund
+			}
+		}
+
+		var err error
+		result.Promotions, err = closeRefundedBooking(ctx, tx, payment, booking)
+		return err
+	}
+	return nil
+}
+
+// closeRefundedBooking cancels the booking of a fully refunded payment, voids its tickets and gives
+// its seats to the waitlist. It only looks at the final state of the payment, so it does the same
+// whether the provider answer or the webhook recorded the refund first. The caller holds the locks
+// on the event, the booking and the payment.
+func closeRefundedBooking(ctx context.Context, tx bun.Tx, payment *models.Payment, booking *models.Booking) ([]models.WaitlistEntry, error) {
+	if payment.AmountRefunded < payment.Amount || booking.Status != models.BookingStatusConfirmed {
+		return nil, nil
+	}
+
+	now := time.Now()
+	booking.Status = models.BookingStatusCancelled
+	booking.CancelledAt = &now
+	if _, err := tx.NewUpdate().Model(booking).Column("status", "cancelled_at").WherePK().Exec(ctx); err != nil {
+		return nil, fmt.Errorf("error cancelling booking with ID %d: %w", booking.BookingID, err)
+	}
+	if err := voidTickets(ctx, tx, booking.BookingID); err != nil {
+		return nil, err
+	}
+	log.Info().Msgf("Booking %d cancelled, payment %s was refunded in full", booking.BookingID, payment.ProviderRef)
+	return promoteWaitlist(ctx, tx, booking.EventID)
+}
+
+// settlePendingRefunds marks the pending card refunds of a payment covered by a refunded amount
+// as succeeded, oldest first, and returns the part of the amount they do not explain
+func settlePendingRefunds(ctx context.Context, tx bun.Tx, paymentID, amount int) (int, error) {
+	var refunds []models.Refund
+	err := tx.NewSelect().
+		Model(&refunds).
+		Where("payment_id = ?", paymentID).
+		Where("status = ?", models.RefundStatusPending).
+		Order("refund_id").
+		For("UPDATE").
+		Scan(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error fetching pending refunds of payment %d: %w", paymentID, err)
+	}
+
+	for i := range refunds {
+		if refunds[i].Amount > amount {
+			break
+		}
+		amount -= refunds[i].Amount
+		_, err := tx.NewUpdate().
+			Model(&refunds[i]).
+			Set("status = ?", models.RefundStatusSucceeded).
+			Set("failure_reason = ''").
+			WherePK().
+			Exec(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("error updating refund with ID %d: %w", refunds[i].RefundID, err)
+		}
+	}
+	return amount, nil
+}
+
+// refundUnkeptPayment records the pending card refund of a payment whose seat could not be kept
+func refundUnkeptPayment(ctx context.Context, tx bun.Tx, payment *models.Payment, booking *models.Booking, amount int) (*models.Refund, error) {
+	refund := &models.Refund{
+		BookingID: booking.BookingID,
+		UserID:    booking.UserID,
+		EventID:   booking.EventID,
+		Amount:    amount,
+		Percent:   100,
+		Method:    models.RefundMethodCard,
+		Status:    models.RefundStatusPending,
+		PaymentID: payment.PaymentID,
+		Reason:    "Seat could not be kept after the payment",
+		Actor:     "system",
+	}
+	if _, err := tx.NewInsert().Model(refund).Exec(ctx); err != nil {
+		return nil, fmt.Errorf("error recording refund of booking %d: %w", booking.BookingID, err)
+	}
+	return refund, nil
+}
@@ -0,0 +1,186 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"eventy/pkg/models"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+)
+
+var (
+	ErrPromoNotFound      = errors.New("promo code not found")
+	ErrPromoNotApplicable = errors.New("promo code is not valid for this event")
+	ErrPromoExhausted     = errors.New("promo code has no redemptions left")
+	ErrPromoUserLimit     = errors.New("promo code already used the maximum number of times")
+)
+
+// NormalizePromoCode returns the stored form of a code typed by a user
+func NormalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// withPromoRedemptions adds the number of bookings holding a seat with the code
+func withPromoRedemptions(q *bun.SelectQuery) *bun.SelectQuery {
+	return q.ColumnExpr("promo_code.*").
+		ColumnExpr(`(SELECT COUNT(*) FROM booking b WHERE b.promo_id = promo_code.promo_id AND b.status IN (?)) AS redemptions`,
+			bun.In(models.BookingHeldStatuses))
+}
+
+// countPromoRedemptions counts the bookings holding a seat with the code, of one user when userID is set.
+// Released and cancelled bookings give their redemption back.
+func countPromoRedemptions(ctx context.Context, db bun.IDB, promoID, userID int) (int, error) {
+	q := db.NewSelect().
+		Model((*models.Booking)(nil)).
+		Where("promo_id = ?", promoID).
+		Where("status IN (?)", bun.In(models.BookingHeldStatuses))
+	if userID != 0 {
+		q = q.Where("user_id = ?", userID)
+	}
+	count, err := q.Count(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error counting redemptions of promo code %d: %w", promoID, err)
+	}
+	return count, nil
+}
+
+// applyPromoCode checks a code against the event and user inside the booking transaction.
+// The promo row is locked so concurrent bookings cannot exceed its limits. An empty code returns nil.
+func applyPromoCode(ctx context.Context, tx bun.Tx, code string, event *models.Event, userID int) (*models.PromoCode, error) {
+	code = NormalizePromoCode(code)
+	if code == "" {
+		return nil, nil
+	}
+
+	promo := new(models.PromoCode)
+	err := tx.NewSelect().Model(promo).Where("code = ?", code).For("UPDATE").Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPromoNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching promo code %s: %w", code, err)
+	}
+
+	now := time.Now()
+	if !promo.IsActive ||
+		(promo.ValidFrom != nil && now.Before(*promo.ValidFrom)) ||
+		(promo.ValidUntil != nil && !now.Before(*promo.ValidUntil)) {
+		return nil, ErrPromoNotApplicable
+	}
+	if len(promo.EventIDs) > 0 || len(promo.CategoryIDs) > 0 {
+		if !slices.Contains(promo.EventIDs, event.EventID) && !slices.Contains(promo.CategoryIDs, event.Category) {
+			return nil, ErrPromoNotApplicable
+		}
+	}
+
+	if promo.MaxRedemptions > 0 {
+		used, err := countPromoRedemptions(ctx, tx, promo.PromoID, 0)
+		if err != nil {
+			return nil, err
+		}
+		if used >= promo.MaxRedemptions {
+			return nil, ErrPromoExhausted
+		}
+	}
+	if promo.PerUserLimit > 0 {
+		used, err := countPromoRedemptions(ctx, tx, promo.PromoID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if used >= promo.PerUserLimit {
+			return nil, ErrPromoUserLimit
+		}
+	}
+
+	return promo, nil
+}
+
+// GetPromoCodes retrieves every promo code with its redemption count
+func GetPromoCodes(ctx context.Context) ([]models.PromoCode, error) {
+	var promos []models.PromoCode
+	err := Db_GlobalVar.NewSelect().
+		Model(&promos).
+		Apply(withPromoRedemptions).
+		Order("promo_id DESC").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting promo codes: %w", err)
+	}
+	return promos, nil
+}
+
+// GetPromoCodeByID retrieves a single promo code with its redemption count
+func GetPromoCodeByID(ctx context.Context, id int) (*models.PromoCode, error) {
+	promo := new(models.PromoCode)
+	err := Db_GlobalVar.NewSelect().
+		Model(promo).
+		Apply(withPromoRedemptions).
+		Where("promo_id = ?", id).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPromoNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting promo code by ID %d: %w", id, err)
+	}
+	return promo, nil
+}
+
+// GetPromoCodeByCode retrieves a promo code by its code
+func GetPromoCodeByCode(ctx context.Context, code string) (*models.PromoCode, error) {
+	promo := new(models.PromoCode)
+	err := Db_GlobalVar.NewSelect().Model(promo).Where("code = ?", NormalizePromoCode(code)).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPromoNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting promo code %s: %w", code, err)
+	}
+	return promo, nil
+}
+
+// AddPromoCode creates a new promo code
+func AddPromoCode(ctx context.Context, promo *models.PromoCode) error {
+	promo.Code = NormalizePromoCode(promo.Code)
+	_, err := Db_GlobalVar.NewInsert().Model(promo).Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("error creating promo code: %w", err)
+	}
+	log.Debug().Msgf("New promo code added with ID: %d", promo.PromoID)
+	return nil
+}
+
+// UpdatePromoCode replaces the settings of a promo code, its redemptions are kept
+func UpdatePromoCode(ctx context.Context, id int, promo *models.PromoCode) (int64, error) {
+	promo.Code = NormalizePromoCode(promo.Code)
+	res, err := Db_GlobalVar.NewUpdate().
+		Model(promo).
+		ExcludeColumn("promo_id", "created_at").
+		Where("promo_id = ?", id).
+		Exec(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error updating promo code with ID %d: %w", id, err)
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	log.Debug().Msgf("Updated promo code with ID: %d, rows affected: %d", id, rowsAffected)
+	return rowsAffected, nil
+}
+
+// DeletePromoCode removes a promo code, bookings keep the code they were priced with
+func DeletePromoCode(ctx context.Context, id int) (int64, error) {
+	res, err := Db_GlobalVar.NewDelete().Model((*models.PromoCode)(nil)).Where("promo_id = ?", id).Exec(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting promo code with ID %d: %w", id, err)
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	log.Debug().Msgf("Deleted promo code with ID: %d, rows affected: %d", id, rowsAffected)
+	return rowsAffected, nil
+}
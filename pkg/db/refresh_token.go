@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"eventy/pkg/models"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid")
+	ErrRefreshTokenExpired = errors.New("refresh token has expired")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used, session revoked")
+)
+
+// AddRefreshToken stores a new refresh token
+func AddRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	_, err := Db_GlobalVar.NewInsert().Model(token).Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("error creating refresh token: %w", err)
+	}
+	log.Debug().Msgf("New refresh token added for user ID: %d", token.UserID)
+	return nil
+}
+
+// RotateRefreshToken swaps the refresh token matching hash for next, in the same family.
+// Presenting an already rotated or revoked token revokes the whole family.
+func RotateRefreshToken(ctx context.Context, hash string, next *models.RefreshToken) (*models.RefreshToken, error) {
+	var current models.RefreshToken
+	var reused bool
+
+	err := Db_GlobalVar.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewSelect().
+			Model(&current).
+			Where("token_hash = ?", hash).
+			For("UPDATE").
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRefreshTokenInvalid
+		}
+		if err != nil {
+			return fmt.Errorf("error fetching refresh token: %w", err)
+		}
+
+		now := time.Now()
+
+		if current.RevokedAt != nil {
+			// Replay of a consumed token: kill every token of the family
+			reused = true
+			return revokeFamily(ctx, tx, current.FamilyID, now)
+		}
+
+		if current.ExpiresAt.Before(now) {
+			return ErrRefreshTokenExpired
+		}
+
+		next.FamilyID = current.FamilyID
+		next.UserID = current.UserID
+		if _, err := tx.NewInsert().Model(next).Exec(ctx); err != nil {
+			return fmt.Errorf("error creating refresh token: %w", err)
+		}
+
+		_, err = tx.NewUpdate().
+			Model((*models.RefreshToken)(nil)).
+			Set("revoked_at = ?", now).
+			Set("replaced_by = ?", next.TokenID).
+			Where("token_id = ?", current.TokenID).
+			Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("error revoking refresh token: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if reused {
+		log.Warn().Int("UserID", current.UserID).Str("FamilyID", current.FamilyID).Msg("Refresh token reuse detected, family revoked")
+		return nil, ErrRefreshTokenReused
+	}
+
+	log.Debug().Msgf("Refresh token rotated for user ID: %d", current.UserID)
+	return next, nil
+}
+
+// RevokeRefreshTokenFamily revokes the session the token belongs to and returns its user ID
+func RevokeRefreshTokenFamily(ctx context.Context, hash string) (int, error) {
+	var token models.RefreshToken
+	err := Db_GlobalVar.NewSelect().Model(&token).Where("token_hash = ?", hash).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error fetching refresh token: %w", err)
+	}
+
+	if err := revokeFamily(ctx, Db_GlobalVar, token.FamilyID, time.Now()); err != nil {
+		return 0, err
+	}
+	return token.UserID, nil
+}
+
+// RevokeAllUserRefreshTokens revokes every session of a user (log out all devices)
+func RevokeAllUserRefreshTokens(ctx context.Context, userID int) (int64, error) {
+	res, err := Db_GlobalVar.NewUpdate().
+		Model((*models.RefreshToken)(nil)).
+		Set("revoked_at = ?", time.Now()).
+		Where("user_id = ?", userID).
+		Where("revoked_at IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error revoking refresh tokens of user with ID %d: %w", userID, err)
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	log.Debug().Msgf("Revoked refresh tokens of user ID: %d, rows affected: %d", userID, rowsAffected)
+	return rowsAffected, nil
+}
+
+func revokeFamily(ctx context.Context, db bun.IDB, familyID string, now time.Time) error {
+	_, err := db.NewUpdate().
+		Model((*models.RefreshToken)(nil)).
+		Set("revoked_at = ?", now).
+		Where("family_id = ?", familyID).
+		Where("revoked_at IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("error revoking refresh token family %s: %w", familyID, err)
+	}
+	return nil
+}
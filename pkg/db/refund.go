@@ -0,0 +1,330 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"eventy/pkg/models"
+	"eventy/pkg/pricing"
+	"fmt"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+)
+
+var (
+	ErrRefundNotFound     = errors.New("refund not found")
+	ErrRefundTooLarge     = errors.New("refund exceeds the amount left to refund")
+	ErrRefundNotRetryable = errors.New("only failed refunds can be retried")
+)
+
+// RefundBookingParams describes a partial refund that keeps the booking
+type RefundBookingParams struct {
+	BookingID int
+	Amount    int
+	Reason    string
+	Actor     string
+}
+
+// isCardPayment reports whether the booking was paid through the payment provider
+func isCardPayment(booking *models.Booking) bool {
+	switch booking.PaymentRef {
+	case "", models.PaymentRefWallet, "legacy":
+		return false
+	}
+	return true
+}
+
+// refundedAmount returns what was already given back for the booking, failed refunds excluded
+func refundedAmount(ctx context.Context, db bun.IDB, bookingID int) (int, error) {
+	var total int
+	err := db.NewSelect().
+		Model((*models.Refund)(nil)).
+		ColumnExpr("COALESCE(SUM(amount), 0)").
+		Where("booking_id = ?", bookingID).
+		Where("status <> ?", models.RefundStatusFailed).
+		Scan(ctx, &total)
+	if err != nil {
+		return 0, fmt.Errorf("error summing refunds of booking %d: %w", bookingID, err)
+	}
+	return total, nil
+}
+
+// issueRefund records a refund through the payment method of the booking, inside the caller transaction.
+// Wallet refunds are credited right away, card refunds stay pending until sent to the provider.
+func issueRefund(ctx context.Context, tx bun.Tx, booking *models.Booking, amount, percent int, reason, actor string) (*models.Refund, error) {
+	refund := &models.Refund{
+		BookingID: booking.BookingID,
+		UserID:    booking.UserID,
+		EventID:   booking.EventID,
+		Amount:    amount,
+		Percent:   percent,
+		Method:    models.PaymentRefWallet,
+		Status:    models.RefundStatusSucceeded,
+		Reason:    reason,
+		Actor:     actor,
+	}
+
+	if isCardPayment(booking) {
+		var payment models.Payment
+		err := tx.NewSelect().Model(&payment).Where("provider_ref = ?", booking.PaymentRef).Scan(ctx)
+		switch {
+		case err == nil:
+			refund.Method = models.RefundMethodCard
+			refund.PaymentID = payment.PaymentID
+			if amount > 0 {
+				refund.Status = models.RefundStatusPending
+			}
+		case errors.Is(err, sql.ErrNoRows):
+			log.Warn().Msgf("Payment %s of booking %d not found, refunding to the wallet", booking.PaymentRef, booking.BookingID)
+		default:
+			return nil, fmt.Errorf("error fetching payment of booking %d: %w", booking.BookingID, err)
+		}
+	}
+
+	// The wallet holds the platform currency, a refund in another one cannot be credited to it
+	if refund.Method == models.PaymentRefWallet && amount > 0 {
+		var event models.Event
+		err := tx.NewSelect().Model(&event).Column("event_id", "currency").Where("event_id = ?", booking.EventID).Scan(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching event with ID %d: %w", booking.EventID, err)
+		}
+		if !pricing.WalletAccepts(&event) {
+			return nil, ErrWalletCurrency
+		}
+	}
+
+	if _, err := tx.NewInsert().Model(refund).Exec(ctx); err != nil {
+		return nil, fmt.Errorf("error recording refund of booking %d: %w", booking.BookingID, err)
+	}
+
+	if refund.Method == models.PaymentRefWallet && amount > 0 {
+		err := postWalletTransaction(ctx, tx, &models.WalletTransaction{
+			UserID:  booking.UserID,
+			Amount:  amount,
+			RefType: models.WalletRefRefund,
+			RefID:   strconv.Itoa(refund.RefundID),
+			Reason:  fmt.Sprintf("Refund of booking %d (%d%%)", booking.BookingID, percent),
+			Actor:   actor,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error refunding user with ID %d: %w", booking.UserID, err)
+		}
+	}
+
+	return refund, nil
+}
+
+// RefundBooking gives back part of what was paid for a booking without cancelling it
+func RefundBooking(ctx context.Context, params RefundBookingParams) (*models.Refund, error) {
+	var refund *models.Refund
+
+	err := Db_GlobalVar.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		booking, err := lockBooking(ctx, tx, params.BookingID)
+		if err != nil {
+			return err
+		}
+		if booking.Status == models.BookingStatusPending {
+			return ErrBookingNotActive
+		}
+
+		refunded, err := refundedAmount(ctx, tx, booking.BookingID)
+		if err != nil {
+			return err
+		}
+		if params.Amount <= 0 || params.Amount > booking.PricePaid-refunded {
+			return ErrRefundTooLarge
+		}
+
+		percent := params.Amount * 100 / max(booking.PricePaid, 1)
+		refund, err = issueRefund(ctx, tx, booking, params.Amount, percent, params.Reason, params.Actor)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Msgf("Booking %d refunded %d by %s (%s, %s)", params.BookingID, refund.Amount, params.Actor, refund.Method, refund.Status)
+	return refund, nil
+}
+
+// GetRefundByID retrieves a single refund by its ID
+func GetRefundByID(ctx context.Context, id int) (*models.Refund, error) {
+	refund := new(models.Refund)
+	err := Db_GlobalVar.NewSelect().Model(refund).Where("refund_id = ?", id).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRefundNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting refund by ID %d: %w", id, err)
+	}
+	return refund, nil
+}
+
+// GetPaymentByID retrieves a single payment by its ID
+func GetPaymentByID(ctx context.Context, id int) (*models.Payment, error) {
+	payment := new(models.Payment)
+	err := Db_GlobalVar.NewSelect().Model(payment).Where("payment_id = ?", id).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPaymentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting payment by ID %d: %w", id, err)
+	}
+	return payment, nil
+}
+
+// GetUnsentCardRefunds lists the card refunds not sent to the provider yet
+func GetUnsentCardRefunds(ctx context.Context) ([]models.Refund, error) {
+	var refunds []models.Refund
+	err := Db_GlobalVar.NewSelect().
+		Model(&refunds).
+		Where("method = ?", models.RefundMethodCard).
+		Where("status = ?", models.RefundStatusPending).
+		Where("COALESCE(provider_ref, '') = ''").
+		Order("refund_id").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting pending card refunds: %w", err)
+	}
+	return refunds, nil
+}
+
+// CompleteCardRefund records the provider answer to a card refund.
+// The webhook may have settled the refund already, in which case only the provider reference is stored.
+// A booking whose payment is now refunded in full is cancelled, the waitlist entries that got its seats are returned.
+func CompleteCardRefund(ctx context.Context, refundID int, providerRef, providerStatus string) (*models.Refund, []models.WaitlistEntry, error) {
+	refund, err := GetRefundByID(ctx, refundID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var promotions []models.WaitlistEntry
+	err = Db_GlobalVar.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// Event, booking, payment then refund, the order the webhook takes
+		booking, err := lockBooking(ctx, tx, refund.BookingID)
+		if err != nil {
+			return err
+		}
+		var payment models.Payment
+		err = tx.NewSelect().Model(&payment).Where("payment_id = ?", refund.PaymentID).For("UPDATE").Scan(ctx)
+		if err != nil {
+			return fmt.Errorf("error fetching payment %d: %w", refund.PaymentID, err)
+		}
+		err = tx.NewSelect().Model(refund).Where("refund_id = ?", refundID).For("UPDATE").Scan(ctx)
+		if err != nil {
+			return fmt.Errorf("error fetching refund with ID %d: %w", refundID, err)
+		}
+
+		refund.ProviderRef = providerRef
+		refund.FailureReason = ""
+		switch {
+		case refund.Status != models.RefundStatusPending:
+			// settled by the webhook meanwhile
+		case providerStatus == "succeeded":
+			refund.Status = models.RefundStatusSucceeded
+			if err := addPaymentRefunded(ctx, tx, &payment, refund.Amount); err != nil {
+				return err
+			}
+		case providerStatus == "failed" || providerStatus == "canceled":
+			refund.Status = models.RefundStatusFailed
+			refund.FailureReason = "refund " + providerStatus + " by the provider"
+		}
+
+		_, err = tx.NewUpdate().Model(refund).Column("status", "provider_ref", "failure_reason").WherePK().Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("error updating refund with ID %d: %w", refundID, err)
+		}
+
+		promotions, err = closeRefundedBooking(ctx, tx, &payment, booking)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return refund, promotions, nil
+}
+
+// FailCardRefund records a provider error, the refund can be retried from the back-office
+func FailCardRefund(ctx context.Context, refundID int, reason string) error {
+	_, err := Db_GlobalVar.NewUpdate().
+		Model((*models.Refund)(nil)).
+		Set("status = ?", models.RefundStatusFailed).
+		Set("failure_reason = ?", reason).
+		Where("refund_id = ?", refundID).
+		Where("status = ?", models.RefundStatusPending).
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("error updating refund with ID %d: %w", refundID, err)
+	}
+	return nil
+}
+
+// RetryRefund puts a failed card refund back in the pending state as a new attempt.
+// Refunds issued since the failure count against the booking, the retry is refused
+// when the booking has no longer enough left to refund.
+func RetryRefund(ctx context.Context, refundID int) (*models.Refund, error) {
+	refund, err := GetRefundByID(ctx, refundID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = Db_GlobalVar.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// The event and the booking are locked first, as when refunds are issued
+		booking, err := lockBooking(ctx, tx, refund.BookingID)
+		if err != nil {
+			return err
+		}
+
+		err = tx.NewSelect().Model(refund).Where("refund_id = ?", refundID).For("UPDATE").Scan(ctx)
+		if err != nil {
+			return fmt.Errorf("error fetching refund with ID %d: %w", refundID, err)
+		}
+		if refund.Method != models.RefundMethodCard || refund.Status != models.RefundStatusFailed {
+			return ErrRefundNotRetryable
+		}
+
+		// Failed refunds are left out, so this one is not counted twice
+		refunded, err := refundedAmount(ctx, tx, booking.BookingID)
+		if err != nil {
+			return err
+		}
+		if refund.Amount > booking.PricePaid-refunded {
+			return ErrRefundTooLarge
+		}
+
+		refund.Status = models.RefundStatusPending
+		refund.ProviderRef = ""
+		refund.Attempts++
+		_, err = tx.NewUpdate().
+			Model(refund).
+			Set("status = ?", refund.Status).
+			Set("provider_ref = NULL").
+			Set("attempts = ?", refund.Attempts).
+			WherePK().
+			Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("error updating refund with ID %d: %w", refundID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+// addPaymentRefunded adds a settled refund to the total refunded on the locked payment
+func addPaymentRefunded(ctx context.Context, tx bun.Tx, payment *models.Payment, amount int) error {
+	payment.AmountRefunded += amount
+	payment.Status = models.PaymentStatusPartiallyRefunded
+	if payment.AmountRefunded >= payment.Amount {
+		payment.Status = models.PaymentStatusRefunded
+	}
+	_, err := tx.NewUpdate().Model(payment).Column("status", "amount_refunded").WherePK().Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("error updating payment %d: %w", payment.PaymentID, err)
+	}
+	return nil
+}
@@ -1,7 +1,31 @@
 package db
 
 import (
+	"eventy/pkg/models"
+
 	"github.com/uptrace/bun"
 )
 
 var Db_GlobalVar *bun.DB
+
+// Models lists the tables created on startup, before the migrations run
+func Models() []interface{} {
+	return []interface{}{
+		&models.User{},
+		&models.Event{},
+		&models.Category{},
+		&models.Booking{},
+		&models.Refund{},
+		&models.Operator{},
+		&models.RefreshToken{},
+		&models.UserToken{},
+		&models.WaitlistEntry{},
+		&models.WalletTransaction{},
+		&models.Payment{},
+		&models.WebhookEvent{},
+		&models.PromoCode{},
+		&models.Ticket{},
+		&models.CheckIn{},
+		&models.TicketType{},
+	}
+}
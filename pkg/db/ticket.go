@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"eventy/pkg/models"
+	"eventy/pkg/ticket"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+var (
+	ErrTicketNotFound  = errors.New("ticket not found")
+	ErrTicketForbidden = errors.New("ticket belongs to another user")
+)
+
+// issueTickets creates one ticket per seat of a confirmed booking inside the caller transaction,
+// the attendees named on the booking get the first tickets in order
+func issueTickets(ctx context.Context, tx bun.Tx, booking *models.Booking) ([]models.Ticket, error) {
+	tickets := make([]models.Ticket, max(booking.Seats, 1))
+	for i := range tickets {
+		code, err := ticket.NewCode()
+		if err != nil {
+			return nil, err
+		}
+		tickets[i] = models.Ticket{
+			BookingID: booking.BookingID,
+			EventID:   booking.EventID,
+			UserID:    booking.UserID,
+			Code:      code,
+			Status:    models.TicketStatusValid,
+		}
+		if i < len(booking.Attendees) {
+			tickets[i].AttendeeName = strings.TrimSpace(booking.Attendees[i].Name)
+			tickets[i].AttendeeEmail = strings.TrimSpace(booking.Attendees[i].Email)
+		}
+	}
+	if _, err := tx.NewInsert().Model(&tickets).Exec(ctx); err != nil {
+		return nil, fmt.Errorf("error issuing tickets of booking %d: %w", booking.BookingID, err)
+	}
+	return tickets, nil
+}
+
+// voidTickets invalidates the tickets of a cancelled booking inside the caller transaction
+func voidTickets(ctx context.Context, tx bun.Tx, bookingID int) error {
+	_, err := tx.NewUpdate().
+		Model((*models.Ticket)(nil)).
+		Set("status = ?", models.TicketStatusVoid).
+		Set("voided_at = ?", time.Now()).
+		Where("booking_id = ?", bookingID).
+		Where("status = ?", models.TicketStatusValid).
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("error voiding tickets of booking %d: %w", bookingID, err)
+	}
+	return nil
+}
+
+// GetTicketsByUser retrieves the tickets of a user, most recent first
+func GetTicketsByUser(ctx context.Context, userID int) ([]models.Ticket, error) {
+	var tickets []models.Ticket
+	err := Db_GlobalVar.NewSelect().
+		Model(&tickets).
+		Where("user_id = ?", userID).
+		Order("ticket_id DESC").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting tickets of user %d: %w", userID, err)
+	}
+	return tickets, nil
+}
+
+// GetTicketsByBooking retrieves the tickets of a booking
+func GetTicketsByBooking(ctx context.Context, bookingID int) ([]models.Ticket, error) {
+	var tickets []models.Ticket
+	err := Db_GlobalVar.NewSelect().
+		Model(&tickets).
+		Where("booking_id = ?", bookingID).
+		Order("ticket_id").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting tickets of booking %d: %w", bookingID, err)
+	}
+	return tickets, nil
+}
+
+// GetTicketByID retrieves a single ticket by its ID
+func GetTicketByID(ctx context.Context, id int) (*models.Ticket, error) {
+	t := new(models.Ticket)
+	err := Db_GlobalVar.NewSelect().Model(t).Where("ticket_id = ?", id).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTicketNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting ticket by ID %d: %w", id, err)
+	}
+	return t, nil
+}
+
+// ReassignTicketParams describes the new attendee of a ticket
+type ReassignTicketParams struct {
+	TicketID int
+	OwnerID  int // when set, the ticket must belong to this user
+	Name     string
+	Email    string
+}
+
+// ReassignTicket hands a valid ticket not checked in yet to another attendee. The ticket gets a
+// new code so the QR code given to the previous attendee no longer gets in.
+func ReassignTicket(ctx context.Context, params ReassignTicketParams) (*models.Ticket, error) {
+	t := new(models.Ticket)
+	err := Db_GlobalVar.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewSelect().Model(t).Where("ticket_id = ?", params.TicketID).For("UPDATE").Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrTicketNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("error fetching ticket with ID %d: %w", params.TicketID, err)
+		}
+		if params.OwnerID != 0 && t.UserID != params.OwnerID {
+			return ErrTicketForbidden
+		}
+		if t.Status != models.TicketStatusValid {
+			return ErrTicketVoid
+		}
+
+		checkedIn, err := tx.NewSelect().Model((*models.CheckIn)(nil)).Where("ticket_id = ?", t.TicketID).Exists(ctx)
+		if err != nil {
+			return fmt.Errorf("error checking check-in of ticket %d: %w", t.TicketID, err)
+		}
+		if checkedIn {
+			return ErrAlreadyCheckedIn
+		}
+
+		if t.Code, err = ticket.NewCode(); err != nil {
+			return err
+		}
+		t.AttendeeName = strings.TrimSpace(params.Name)
+		t.AttendeeEmail = strings.TrimSpace(params.Email)
+		_, err = tx.NewUpdate().Model(t).Column("code", "attendee_name", "attendee_email").WherePK().Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("error reassigning ticket %d: %w", t.TicketID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
@@ -0,0 +1,301 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"eventy/pkg/models"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+)
+
+var (
+	ErrTicketTypeNotFound  = errors.New("ticket type not found")
+	ErrTicketTypeRequired  = errors.New("a ticket type is required for this event")
+	ErrTicketTypeNotOnSale = errors.New("ticket type is not on sale")
+	ErrTicketTypeSoldOut   = errors.New("ticket type is sold out")
+	ErrTicketTypeQuota     = errors.New("ticket type quotas exceed the event capacity")
+	ErrTicketTypeOversold  = errors.New("quota is below the tickets already sold")
+	ErrTicketTypeInUse     = errors.New("ticket type has bookings")
+)
+
+// withTicketTypeSold selects the ticket type columns plus the seats held on the type
+func withTicketTypeSold(q *bun.SelectQuery) *bun.SelectQuery {
+	return q.ColumnExpr("?TableAlias.*").
+		ColumnExpr(`(SELECT COALESCE(SUM(b.seats), 0) FROM booking AS b WHERE b.ticket_type_id = ?TableAlias.ticket_type_id AND b.status IN (?)) AS sold`,
+			bun.In(models.BookingHeldStatuses))
+}
+
+// withStock fills the fields computed from the sold count
+func withStock(types []models.TicketType) []models.TicketType {
+	now := time.Now()
+	for i := range types {
+		types[i].Remaining = max(types[i].Quota-types[i].Sold, 0)
+		types[i].OnSale = types[i].IsOnSale(now) && types[i].Remaining > 0
+	}
+	return types
+}
+
+// countTicketTypeSold returns the number of seats taken on a ticket type, pending payments included
+func countTicketTypeSold(ctx context.Context, db bun.IDB, ticketTypeID int) (int, error) {
+	var count int
+	err := db.NewSelect().
+		Model((*models.Booking)(nil)).
+		ColumnExpr("COALESCE(SUM(seats), 0)").
+		Where("ticket_type_id = ?", ticketTypeID).
+		Where("status IN (?)", bun.In(models.BookingHeldStatuses)).
+		Scan(ctx, &count)
+	if err != nil {
+		return 0, fmt.Errorf("error counting bookings of ticket type %d: %w", ticketTypeID, err)
+	}
+	return count, nil
+}
+
+// hasTicketTypes reports whether the event is booked through ticket types
+func hasTicketTypes(ctx context.Context, db bun.IDB, eventID int) (bool, error) {
+	exists, err := db.NewSelect().Model((*models.TicketType)(nil)).Where("event_id = ?", eventID).Exists(ctx)
+	if err != nil {
+		return false, fmt.Errorf("error checking ticket types of event %d: %w", eventID, err)
+	}
+	return exists, nil
+}
+
+// quotaTotal sums the quotas of an event, without the given ticket type
+func quotaTotal(ctx context.Context, db bun.IDB, eventID, exceptID int) (int, error) {
+	var total int
+	err := db.NewSelect().
+		Model((*models.TicketType)(nil)).
+		ColumnExpr("COALESCE(SUM(quota), 0)").
+		Where("event_id = ?", eventID).
+		Where("ticket_type_id <> ?", exceptID).
+		Scan(ctx, &total)
+	if err != nil {
+		return 0, fmt.Errorf("error summing quotas of event %d: %w", eventID, err)
+	}
+	return total, nil
+}
+
+// selectTicketType checks the ticket type chosen for the seats of a booking inside the booking
+// transaction. The event row is locked by reserveSeat, so the quota check cannot race.
+func selectTicketType(ctx context.Context, tx bun.Tx, event *models.Event, ticketTypeID, seats int) (*models.TicketType, error) {
+	if ticketTypeID == 0 {
+		tiered, err := hasTicketTypes(ctx, tx, event.EventID)
+		if err != nil {
+			return nil, err
+		}
+		if tiered {
+			return nil, ErrTicketTypeRequired
+		}
+		return nil, nil
+	}
+
+	ticketType := new(models.TicketType)
+	err := tx.NewSelect().
+		Model(ticketType).
+		Where("ticket_type_id = ?", ticketTypeID).
+		Where("event_id = ?", event.EventID).
+		For("SHARE").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTicketTypeNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching ticket type with ID %d: %w", ticketTypeID, err)
+	}
+	if !ticketType.IsOnSale(time.Now()) {
+		return nil, ErrTicketTypeNotOnSale
+	}
+
+	sold, err := countTicketTypeSold(ctx, tx, ticketTypeID)
+	if err != nil {
+		return nil, err
+	}
+	if sold+seats > ticketType.Quota {
+		return nil, ErrTicketTypeSoldOut
+	}
+	return ticketType, nil
+}
+
+// GetTicketTypesByEvent retrieves the ticket types of an event with their remaining stock
+func GetTicketTypesByEvent(ctx context.Context, eventID int) ([]models.TicketType, error) {
+	var types []models.TicketType
+	err := Db_GlobalVar.NewSelect().
+		Model(&types).
+		Apply(withTicketTypeSold).
+		Where("event_id = ?", eventID).
+		Order("price", "ticket_type_id").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting ticket types of event %d: %w", eventID, err)
+	}
+	return withStock(types), nil
+}
+
+// attachTicketTypes loads the ticket types of the events in one query
+func attachTicketTypes(ctx context.Context, events []models.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	ids := make([]int, len(events))
+	for i := range events {
+		ids[i] = events[i].EventID
+	}
+
+	var types []models.TicketType
+	err := Db_GlobalVar.NewSelect().
+		Model(&types).
+		Apply(withTicketTypeSold).
+		Where("event_id IN (?)", bun.In(ids)).
+		Order("price", "ticket_type_id").
+		Scan(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting ticket types: %w", err)
+	}
+
+	byEvent := make(map[int][]models.TicketType)
+	for _, t := range withStock(types) {
+		byEvent[t.EventID] = append(byEvent[t.EventID], t)
+	}
+	for i := range events {
+		events[i].TicketTypes = byEvent[events[i].EventID]
+	}
+	return nil
+}
+
+// GetTicketTypeByID retrieves a single ticket type with its remaining stock
+func GetTicketTypeByID(ctx context.Context, id int) (*models.TicketType, error) {
+	var types []models.TicketType
+	err := Db_GlobalVar.NewSelect().
+		Model(&types).
+		Apply(withTicketTypeSold).
+		Where("ticket_type_id = ?", id).
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting ticket type by ID %d: %w", id, err)
+	}
+	if len(types) == 0 {
+		return nil, ErrTicketTypeNotFound
+	}
+	return &withStock(types)[0], nil
+}
+
+// checkQuota locks the event and checks that the quotas, with the given one, fit in its capacity
+func checkQuota(ctx context.Context, tx bun.Tx, eventID, ticketTypeID, quota int) error {
+	var event models.Event
+	err := tx.NewSelect().
+		Model(&event).
+		Column("event_id", "max_capacity").
+		Where("event_id = ?", eventID).
+		For("UPDATE").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrEventNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error fetching event with ID %d: %w", eventID, err)
+	}
+
+	total, err := quotaTotal(ctx, tx, eventID, ticketTypeID)
+	if err != nil {
+		return err
+	}
+	if total+quota > event.MaxCapacity {
+		return ErrTicketTypeQuota
+	}
+	return nil
+}
+
+// AddTicketType creates a ticket type, the quotas of the event must fit in its capacity
+func AddTicketType(ctx context.Context, ticketType *models.TicketType) error {
+	err := Db_GlobalVar.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := checkQuota(ctx, tx, ticketType.EventID, 0, ticketType.Quota); err != nil {
+			return err
+		}
+		if _, err := tx.NewInsert().Model(ticketType).Exec(ctx); err != nil {
+			return fmt.Errorf("error creating ticket type: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Debug().Msgf("New ticket type added with ID: %d", ticketType.TicketTypeID)
+	return nil
+}
+
+// UpdateTicketType replaces the settings of a ticket type, it stays on its event
+func UpdateTicketType(ctx context.Context, id int, updates *models.TicketType) error {
+	err := Db_GlobalVar.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var existing models.TicketType
+		err := tx.NewSelect().Model(&existing).Where("ticket_type_id = ?", id).For("UPDATE").Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrTicketTypeNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("error fetching ticket type with ID %d: %w", id, err)
+		}
+
+		if err := checkQuota(ctx, tx, existing.EventID, id, updates.Quota); err != nil {
+			return err
+		}
+		sold, err := countTicketTypeSold(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if updates.Quota < sold {
+			return ErrTicketTypeOversold
+		}
+
+		updates.TicketTypeID = id
+		updates.EventID = existing.EventID
+		_, err = tx.NewUpdate().
+			Model(updates).
+			Column("name", "price", "quota", "sales_start", "sales_end").
+			WherePK().
+			Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("error updating ticket type with ID %d: %w", id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Debug().Msgf("Updated ticket type with ID: %d", id)
+	return nil
+}
+
+// DeleteTicketType removes a ticket type no booking holds a seat of
+func DeleteTicketType(ctx context.Context, id int) (int64, error) {
+	var rowsAffected int64
+	err := Db_GlobalVar.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// Lock the type so no booking takes it while it is deleted
+		_, err := tx.NewSelect().Model((*models.TicketType)(nil)).Where("ticket_type_id = ?", id).For("UPDATE").Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("error fetching ticket type with ID %d: %w", id, err)
+		}
+
+		sold, err := countTicketTypeSold(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if sold > 0 {
+			return ErrTicketTypeInUse
+		}
+
+		res, err := tx.NewDelete().Model((*models.TicketType)(nil)).Where("ticket_type_id = ?", id).Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("error deleting ticket type with ID %d: %w", id, err)
+		}
+		rowsAffected, _ = res.RowsAffected()
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	log.Debug().Msgf("Deleted ticket type with ID: %d, rows affected: %d", id, rowsAffected)
+	return rowsAffected, nil
+}
@@ -2,6 +2,9 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"eventy/functions"
 	"eventy/pkg/models"
 	"fmt"
 	"time"
@@ -10,47 +13,24 @@ import (
 	"github.com/uptrace/bun"
 )
 
+var ErrEmailTaken = errors.New("email is used by another user")
+
 // GetAllUsers retrieves all users from the database
 func GetAllUsers(ctx context.Context) ([]models.User, error) {
 	var users []models.User
 
-	err := Db_GlobalVar.NewSelect().Model(&users).Where("is_guest = ?", false).
+	err := Db_GlobalVar.NewSelect().Model(&users).Apply(withUserBookings).Where("is_guest = ?", false).
 		Scan(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("error getting all users: %w", err)
 	}
 
-	// Remove duplicates from EventID for each user
-	for i := range users {
-		users[i].EventID = removeDuplicates(users[i].EventID)
-	}
-
 	return users, nil
 }
 
-// Helper function to remove duplicates from a slice of integers
-func removeDuplicates(slice []int) []int {
-	if len(slice) == 0 {
-		return slice
-	}
-
-	// Use a map to track unique elements
-	seen := make(map[int]bool)
-	result := make([]int, 0, len(slice))
-
-	for _, item := range slice {
-		if !seen[item] {
-			seen[item] = true
-			result = append(result, item)
-		}
-	}
-
-	return result
-}
-
 func GetAllGuests(ctx context.Context) ([]models.User, error) {
 	var users []models.User
-	err := Db_GlobalVar.NewSelect().Model(&users).Where("is_guest = ?", true).
+	err := Db_GlobalVar.NewSelect().Model(&users).Apply(withUserBookings).Where("is_guest = ?", true).
 		Scan(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("error getting all users: %w", err)
@@ -62,6 +42,7 @@ func GetAllGuests(ctx context.Context) ([]models.User, error) {
 func GetUserByID(ctx context.Context, id int) (*models.User, error) {
 	user := new(models.User)
 	err := Db_GlobalVar.NewSelect().Model(user).
+		Apply(withUserBookings).
 		Where("user_id = ?", id).
 		Where("is_guest = ?", false).
 		Scan(ctx)
@@ -70,9 +51,6 @@ func GetUserByID(ctx context.Context, id int) (*models.User, error) {
 		return nil, fmt.Errorf("error getting user by ID %d: %w", id, err)
 	}
 
-	// Remove duplicates from EventID
-	user.EventID = removeDuplicates(user.EventID)
-
 	if len(user.EventID) == 0 {
 		return user, nil
 	}
@@ -114,13 +92,13 @@ func GetUserByID(ctx context.Context, id int) (*models.User, error) {
 func GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	user := new(models.User)
 	err := Db_GlobalVar.NewSelect().Model(user).
+		Apply(withUserBookings).
 		Where("email = ?", email).
 		Where("is_guest = ?", false).
 		Scan(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("error getting user by Email %s: %w", email, err)
 	}
-	user.EventID = removeDuplicates(user.EventID)
 
 	return user, nil
 }
@@ -128,8 +106,16 @@ func GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 // AddUser creates a new user in the database
 func AddUser(ctx context.Context, user *models.User) error {
 	user.Is_guest = true
-	user.UserID = 13
-	_, err := Db_GlobalVar.NewInsert().Model(user).Exec(ctx)
+	user.UserID = 0  // let the database assign the ID
+	user.Balance = 0 // the balance only moves through the wallet ledger
+
+	hash, err := functions.HashPassword(user.Password)
+	if err != nil {
+		return fmt.Errorf("error hashing password: %w", err)
+	}
+	user.Password = hash
+
+	_, err = Db_GlobalVar.NewInsert().Model(user).Exec(ctx)
 	if err != nil {
 		return fmt.Errorf("error creating user: %w", err)
 	}
@@ -137,54 +123,107 @@ func AddUser(ctx context.Context, user *models.User) error {
 	return nil
 }
 
-// UpdateUser updates an existing user in the database
-func UpdateUser(ctx context.Context, id int, updates *models.User) (int64, error) {
-	res, err := Db_GlobalVar.NewUpdate().
-		Model(updates).
-		Where("user_id = ?", id).
-		OmitZero().
-		Exec(ctx)
-	if err != nil {
-		return 0, fmt.Errorf("error updating user with ID %d: %w", id, err)
+// UpdateUser updates an existing user in the database. A new email is unverified again unless
+// the update says otherwise, verification tokens mailed to the previous address stop working.
+// It returns ErrEmailTaken if another user has the new email.
+func UpdateUser(ctx context.Context, id int, updates *models.User) (rowsAffected int64, emailChanged bool, err error) {
+	updates.Balance = 0 // the balance only moves through the wallet ledger
+
+	if updates.Password != "" {
+		hash, err := functions.HashPassword(updates.Password)
+		if err != nil {
+			return 0, false, fmt.Errorf("error hashing password: %w", err)
+		}
+		updates.Password = hash
 	}
 
-	rowsAffected, _ := res.RowsAffected()
-	log.Debug().Msgf("Updated user with ID: %d, rows affected: %d", id, rowsAffected)
-	return rowsAffected, nil
-}
+	err = Db_GlobalVar.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var current models.User
+		err := tx.NewSelect().
+			Model(&current).
+			Column("email").
+			Where("user_id = ?", id).
+			For("UPDATE").
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error fetching user with ID %d: %w", id, err)
+		}
 
-func TopupBalance(ctx context.Context, id, Balance int) (int64, error) {
-	var updates models.User
-	res, err := Db_GlobalVar.NewUpdate().
-		Model(&updates).
-		Set("balance = balance + ?", Balance). // ✅ Increment the balance
-		Where("user_id = ?", id).
-		Exec(ctx)
+		res, err := tx.NewUpdate().
+			Model(updates).
+			Where("user_id = ?", id).
+			OmitZero().
+			Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("error updating user with ID %d: %w", id, err)
+		}
+		rowsAffected, _ = res.RowsAffected()
+
+		// The email is the key of the table, the model update above never sets it
+		emailChanged = updates.Email != "" && updates.Email != current.Email
+		if !emailChanged {
+			return nil
+		}
+
+		taken, err := tx.NewSelect().
+			Model((*models.User)(nil)).
+			Where("email = ?", updates.Email).
+			Where("user_id <> ?", id).
+			Exists(ctx)
+		if err != nil {
+			return fmt.Errorf("error checking email of user with ID %d: %w", id, err)
+		}
+		if taken {
+			return ErrEmailTaken
+		}
+
+		_, err = tx.NewUpdate().
+			Model((*models.User)(nil)).
+			Set("email = ?", updates.Email).
+			Set("email_verified = ?", updates.EmailVerified).
+			Where("user_id = ?", id).
+			Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("error changing email of user with ID %d: %w", id, err)
+		}
+		if updates.EmailVerified {
+			return nil
+		}
 
+		_, err = tx.NewUpdate().
+			Model((*models.UserToken)(nil)).
+			Set("used_at = ?", time.Now()).
+			Where("user_id = ?", id).
+			Where("purpose = ?", models.TokenPurposeEmailVerification).
+			Where("used_at IS NULL").
+			Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("error invalidating verification tokens of user with ID %d: %w", id, err)
+		}
+		return nil
+	})
 	if err != nil {
-		return 0, fmt.Errorf("error updating user with ID %d: %w", id, err)
+		return 0, false, err
 	}
 
-	rowsAffected, _ := res.RowsAffected()
 	log.Debug().Msgf("Updated user with ID: %d, rows affected: %d", id, rowsAffected)
-	return rowsAffected, nil
+	return rowsAffected, emailChanged, nil
 }
 
-func TopDownBalance(ctx context.Context, id, Balance int) (int64, error) {
-	var updates models.User
-	res, err := Db_GlobalVar.NewUpdate().
-		Model(&updates).
-		Set("balance = balance - ?", Balance).
+// SetUserPasswordHash stores an already hashed password, used to upgrade legacy plaintext rows
+func SetUserPasswordHash(ctx context.Context, id int, hash string) error {
+	_, err := Db_GlobalVar.NewUpdate().
+		Model((*models.User)(nil)).
+		Set("password = ?", hash).
 		Where("user_id = ?", id).
 		Exec(ctx)
-
 	if err != nil {
-		return 0, fmt.Errorf("error updating user with ID %d: %w", id, err)
+		return fmt.Errorf("error updating password of user with ID %d: %w", id, err)
 	}
-
-	rowsAffected, _ := res.RowsAffected()
-	log.Debug().Msgf("Updated user with ID: %d, rows affected: %d", id, rowsAffected)
-	return rowsAffected, nil
+	return nil
 }
 
 // DeleteUser removes a user from the database by their ID
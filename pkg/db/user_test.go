@@ -0,0 +1,70 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"eventy/pkg/db"
+	"eventy/pkg/db/dbtest"
+	"eventy/pkg/models"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+func TestChangingEmailResetsVerification(t *testing.T) {
+	dbtest.Open(t)
+	ctx := context.Background()
+	user := dbtest.NewUser(t, 0)
+
+	verify := func(ctx context.Context, tx bun.Tx, token *models.UserToken) error {
+		return db.MarkEmailVerified(ctx, tx, token.UserID)
+	}
+	hash := fmt.Sprintf("hash-old-address-%d", user.UserID)
+	err := db.AddUserToken(ctx, &models.UserToken{
+		TokenHash: hash,
+		UserID:    user.UserID,
+		Purpose:   models.TokenPurposeEmailVerification,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("adding token: %v", err)
+	}
+
+	// Saving the same email keeps the user verified
+	if err := db.Db_GlobalVar.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		return db.MarkEmailVerified(ctx, tx, user.UserID)
+	}); err != nil {
+		t.Fatalf("verifying email: %v", err)
+	}
+	if _, changed, err := db.UpdateUser(ctx, user.UserID, &models.User{Email: user.Email, Name: "Renamed"}); err != nil || changed {
+		t.Fatalf("same email: changed %v, err %v", changed, err)
+	}
+	if stored, err := db.GetUserByID(ctx, user.UserID); err != nil || !stored.EmailVerified {
+		t.Fatalf("same email: email no longer verified, err %v", err)
+	}
+
+	other := dbtest.NewUser(t, 0)
+	if _, _, err := db.UpdateUser(ctx, user.UserID, &models.User{Email: other.Email, Name: "Renamed"}); !errors.Is(err, db.ErrEmailTaken) {
+		t.Fatalf("email of another user: got %v, want ErrEmailTaken", err)
+	}
+
+	newEmail := "changed-" + user.Email
+	rows, changed, err := db.UpdateUser(ctx, user.UserID, &models.User{Email: newEmail, Name: "Renamed"})
+	if err != nil || rows != 1 || !changed {
+		t.Fatalf("new email: rows %d, changed %v, err %v", rows, changed, err)
+	}
+	stored, err := db.GetUserByID(ctx, user.UserID)
+	if err != nil {
+		t.Fatalf("getting user: %v", err)
+	}
+	if stored.Email != newEmail || stored.EmailVerified {
+		t.Errorf("user %s verified %v, want %s unverified", stored.Email, stored.EmailVerified, newEmail)
+	}
+
+	// The code mailed to the previous address must not verify the new one
+	if _, err := db.ConsumeUserToken(ctx, hash, models.TokenPurposeEmailVerification, verify); !errors.Is(err, db.ErrUserTokenUsed) {
+		t.Errorf("old token: got %v, want ErrUserTokenUsed", err)
+	}
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"eventy/pkg/models"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+)
+
+var (
+	ErrUserTokenInvalid = errors.New("token is invalid")
+	ErrUserTokenExpired = errors.New("token has expired")
+	ErrUserTokenUsed    = errors.New("token was already used")
+)
+
+// AddUserToken stores a new single-use token, older unused tokens of the same purpose are invalidated
+func AddUserToken(ctx context.Context, token *models.UserToken) error {
+	return Db_GlobalVar.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.NewUpdate().
+			Model((*models.UserToken)(nil)).
+			Set("used_at = ?", time.Now()).
+			Where("user_id = ?", token.UserID).
+			Where("purpose = ?", token.Purpose).
+			Where("used_at IS NULL").
+			Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("error invalidating previous tokens: %w", err)
+		}
+
+		if _, err := tx.NewInsert().Model(token).Exec(ctx); err != nil {
+			return fmt.Errorf("error creating user token: %w", err)
+		}
+		log.Debug().Msgf("New %s token added for user ID: %d", token.Purpose, token.UserID)
+		return nil
+	})
+}
+
+// ConsumeUserToken marks the token as used and runs apply in the same transaction
+func ConsumeUserToken(ctx context.Context, hash, purpose string, apply func(ctx context.Context, tx bun.Tx, token *models.UserToken) error) (*models.UserToken, error) {
+	var token models.UserToken
+
+	err := Db_GlobalVar.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewSelect().
+			Model(&token).
+			Where("token_hash = ?", hash).
+			Where("purpose = ?", purpose).
+			For("UPDATE").
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserTokenInvalid
+		}
+		if err != nil {
+			return fmt.Errorf("error fetching user token: %w", err)
+		}
+
+		if token.UsedAt != nil {
+			return ErrUserTokenUsed
+		}
+		now := time.Now()
+		if token.ExpiresAt.Before(now) {
+			return ErrUserTokenExpired
+		}
+
+		_, err = tx.NewUpdate().
+			Model((*models.UserToken)(nil)).
+			Set("used_at = ?", now).
+			Where("token_id = ?", token.TokenID).
+			Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("error consuming user token: %w", err)
+		}
+
+		return apply(ctx, tx, &token)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// ResetUserPassword stores the new password hash and revokes every session of the user
+func ResetUserPassword(ctx context.Context, tx bun.Tx, userID int, hash string) error {
+	_, err := tx.NewUpdate().
+		Model((*models.User)(nil)).
+		Set("password = ?", hash).
+		Where("user_id = ?", userID).
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("error updating password of user with ID %d: %w", userID, err)
+	}
+
+	_, err = tx.NewUpdate().
+		Model((*models.RefreshToken)(nil)).
+		Set("revoked_at = ?", time.Now()).
+		Where("user_id = ?", userID).
+		Where("revoked_at IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("error revoking refresh tokens of user with ID %d: %w", userID, err)
+	}
+	return nil
+}
+
+// MarkEmailVerified flags the email of the user as verified
+func MarkEmailVerified(ctx context.Context, tx bun.Tx, userID int) error {
+	_, err := tx.NewUpdate().
+		Model((*models.User)(nil)).
+		Set("email_verified = ?", true).
+		Where("user_id = ?", userID).
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("error verifying email of user with ID %d: %w", userID, err)
+	}
+	return nil
+}
@@ -0,0 +1,376 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"eventy/config"
+	"eventy/pkg/models"
+	"eventy/pkg/pricing"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+)
+
+var ErrNotOnWaitlist = errors.New("user is not on the waitlist of this event")
+
+// waitlistOpenStatuses are the statuses of entries still queued or holding a seat
+var waitlistOpenStatuses = []string{models.WaitlistStatusWaiting, models.WaitlistStatusOffered}
+
+// waitlistConfirmWindow is how long a promoted user without enough balance keeps the seat
+func waitlistConfirmWindow() time.Duration {
+	minutes := config.Configvar.Booking.WaitlistConfirmMin
+	if minutes <= 0 {
+		minutes = 1440
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// countOpenOffers returns the seats held by unexpired waitlist offers, ignoring the given user
+func countOpenOffers(ctx context.Context, db bun.IDB, eventID, exceptUserID int) (int, error) {
+	count, err := db.NewSelect().
+		Model((*models.WaitlistEntry)(nil)).
+		Where("event_id = ?", eventID).
+		Where("user_id <> ?", exceptUserID).
+		Where("status = ?", models.WaitlistStatusOffered).
+		Where("expires_at > ?", time.Now()).
+		Count(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error counting waitlist offers of event with ID %d: %w", eventID, err)
+	}
+	return count, nil
+}
+
+// countWaiting returns the number of users queued on the event
+func countWaiting(ctx context.Context, db bun.IDB, eventID int) (int, error) {
+	count, err := db.NewSelect().
+		Model((*models.WaitlistEntry)(nil)).
+		Where("event_id = ?", eventID).
+		Where("status = ?", models.WaitlistStatusWaiting).
+		Count(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error counting waitlist of event with ID %d: %w", eventID, err)
+	}
+	return count, nil
+}
+
+// withWaitlistPosition selects the entry columns plus its rank among waiting entries of the event
+func withWaitlistPosition(q *bun.SelectQuery) *bun.SelectQuery {
+	return q.ColumnExpr("?TableAlias.*").
+		ColumnExpr(`CASE WHEN ?TableAlias.status = ? THEN (SELECT COUNT(*) FROM waitlist AS w WHERE w.event_id = ?TableAlias.event_id AND w.status = ? AND w.entry_id <= ?TableAlias.entry_id) ELSE 0 END AS position`,
+			models.WaitlistStatusWaiting, models.WaitlistStatusWaiting)
+}
+
+// JoinWaitlist queues the user on the event, joining twice returns the existing entry
+func JoinWaitlist(ctx context.Context, eventID, userID int) (*models.WaitlistEntry, error) {
+	entry := new(models.WaitlistEntry)
+
+	err := Db_GlobalVar.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// Serialize with bookings and promotions of the same event
+		_, err := tx.NewSelect().
+			Model((*models.Event)(nil)).
+			Column("event_id").
+			Where("event_id = ?", eventID).
+			For("UPDATE").
+			Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("error locking event with ID %d: %w", eventID, err)
+		}
+
+		err = tx.NewSelect().
+			Model(entry).
+			Where("event_id = ?", eventID).
+			Where("user_id = ?", userID).
+			Where("status IN (?)", bun.In(waitlistOpenStatuses)).
+			Scan(ctx)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("error fetching waitlist entry: %w", err)
+		}
+
+		*entry = models.WaitlistEntry{
+			EventID: eventID,
+			UserID:  userID,
+			Status:  models.WaitlistStatusWaiting,
+		}
+		if _, err := tx.NewInsert().Model(entry).Exec(ctx); err != nil {
+			return fmt.Errorf("error joining waitlist: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Msgf("User %d is on the waitlist of event %d (entry %d)", userID, eventID, entry.EntryID)
+	return GetWaitlistEntry(ctx, entry.EntryID)
+}
+
+// GetWaitlistEntry retrieves an entry with its current position
+func GetWaitlistEntry(ctx context.Context, id int) (*models.WaitlistEntry, error) {
+	entry := new(models.WaitlistEntry)
+	err := Db_GlobalVar.NewSelect().Model(entry).Apply(withWaitlistPosition).Where("entry_id = ?", id).Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting waitlist entry by ID %d: %w", id, err)
+	}
+	return entry, nil
+}
+
+// GetWaitlistByUser retrieves the open waitlist entries of a user
+func GetWaitlistByUser(ctx context.Context, userID int) ([]models.WaitlistEntry, error) {
+	var entries []models.WaitlistEntry
+	err := Db_GlobalVar.NewSelect().
+		Model(&entries).
+		Apply(withWaitlistPosition).
+		Where("user_id = ?", userID).
+		Where("status IN (?)", bun.In(waitlistOpenStatuses)).
+		Order("entry_id").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting waitlist of user with ID %d: %w", userID, err)
+	}
+	return entries, nil
+}
+
+// GetWaitlistByEvent retrieves the waitlist of an event in queue order
+func GetWaitlistByEvent(ctx context.Context, eventID int) ([]models.WaitlistEntry, error) {
+	var entries []models.WaitlistEntry
+	err := Db_GlobalVar.NewSelect().
+		Model(&entries).
+		Apply(withWaitlistPosition).
+		Where("event_id = ?", eventID).
+		Order("entry_id").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting waitlist of event with ID %d: %w", eventID, err)
+	}
+	return entries, nil
+}
+
+// LeaveWaitlist removes the user from the waitlist of the event and hands a held seat to the next user
+func LeaveWaitlist(ctx context.Context, eventID, userID int) ([]models.WaitlistEntry, error) {
+	var promotions []models.WaitlistEntry
+
+	err := Db_GlobalVar.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.NewUpdate().
+			Model((*models.WaitlistEntry)(nil)).
+			Set("status = ?", models.WaitlistStatusLeft).
+			Where("event_id = ?", eventID).
+			Where("user_id = ?", userID).
+			Where("status IN (?)", bun.In(waitlistOpenStatuses)).
+			Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("error leaving waitlist: %w", err)
+		}
+		if rows, _ := res.RowsAffected(); rows == 0 {
+			return ErrNotOnWaitlist
+		}
+
+		promotions, err = promoteWaitlist(ctx, tx, eventID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return promotions, nil
+}
+
+// PromoteWaitlist fills the free seats of the event from its waitlist
+func PromoteWaitlist(ctx context.Context, eventID int) ([]models.WaitlistEntry, error) {
+	var promotions []models.WaitlistEntry
+	err := Db_GlobalVar.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		promotions, err = promoteWaitlist(ctx, tx, eventID)
+		return err
+	})
+	return promotions, err
+}
+
+// promoteWaitlist fills free seats in queue order inside the caller transaction.
+// A user with enough balance is booked and charged right away when the event is priced in the
+// wallet currency, otherwise the seat is held
+// for the confirmation window and the user must book the event to confirm.
+func promoteWaitlist(ctx context.Context, tx bun.Tx, eventID int) ([]models.WaitlistEntry, error) {
+	var event models.Event
+	err := tx.NewSelect().
+		Model(&event).
+		Column("event_id", "max_capacity", "price", "currency", "status").
+		Where("event_id = ?", eventID).
+		For("UPDATE").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching event with ID %d: %w", eventID, err)
+	}
+	if event.Status == models.EventStatusCancelled {
+		return nil, nil
+	}
+
+	// The tier of a seat is chosen by the user, tiered events only offer seats
+	tiered, err := hasTicketTypes(ctx, tx, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	var promotions []models.WaitlistEntry
+	for {
+		seats, err := countActiveSeats(ctx, tx, eventID)
+		if err != nil {
+			return nil, err
+		}
+		offers, err := countOpenOffers(ctx, tx, eventID, 0)
+		if err != nil {
+			return nil, err
+		}
+		if seats+offers >= event.MaxCapacity {
+			break
+		}
+
+		var entry models.WaitlistEntry
+		err = tx.NewSelect().
+			Model(&entry).
+			Where("event_id = ?", eventID).
+			Where("status = ?", models.WaitlistStatusWaiting).
+			Order("entry_id").
+			Limit(1).
+			For("UPDATE").
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error fetching waitlist of event with ID %d: %w", eventID, err)
+		}
+
+		var user models.User
+		err = tx.NewSelect().
+			Model(&user).
+			Column("user_id", "balance").
+			Where("user_id = ?", entry.UserID).
+			Where("is_guest = ?", false).
+			For("UPDATE").
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			// The account is gone or not accepted, skip it
+			entry.Status = models.WaitlistStatusExpired
+			if _, err := tx.NewUpdate().Model(&entry).Column("status").WherePK().Exec(ctx); err != nil {
+				return nil, fmt.Errorf("error updating waitlist entry %d: %w", entry.EntryID, err)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error fetching user with ID %d: %w", entry.UserID, err)
+		}
+
+		now := time.Now()
+		entry.OfferedAt = &now
+
+		if price := pricing.Wallet(&event, nil, nil, 1).Total; !tiered && pricing.WalletAccepts(&event) && user.Balance >= price {
+			booking := &models.Booking{UserID: entry.UserID, EventID: eventID, Seats: 1, PricePaid: price}
+			if err := insertWalletBooking(ctx, tx, booking, "system"); err != nil {
+				return nil, err
+			}
+			entry.Status = models.WaitlistStatusPromoted
+			entry.BookingID = booking.BookingID
+		} else {
+			expiresAt := now.Add(waitlistConfirmWindow())
+			entry.Status = models.WaitlistStatusOffered
+			entry.ExpiresAt = &expiresAt
+		}
+
+		_, err = tx.NewUpdate().
+			Model(&entry).
+			Column("status", "offered_at", "expires_at", "booking_id").
+			WherePK().
+			Exec(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error updating waitlist entry %d: %w", entry.EntryID, err)
+		}
+
+		log.Info().Msgf("Waitlist entry %d of event %d is now %s", entry.EntryID, eventID, entry.Status)
+		promotions = append(promotions, entry)
+	}
+
+	return promotions, nil
+}
+
+// ExpireWaitlistOffers expires the offers not confirmed in time and hands the seats to the next users.
+// The events are locked in event_id order before their waitlist rows, the order bookings take them in,
+// so the job cannot deadlock with a booking confirming an offer.
+func ExpireWaitlistOffers(ctx context.Context) (expired []models.WaitlistEntry, promotions []models.WaitlistEntry, err error) {
+	now := time.Now()
+	err = Db_GlobalVar.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var eventIDs []int
+		err := tx.NewSelect().
+			Model((*models.Event)(nil)).
+			Column("event_id").
+			Where("event_id IN (?)", tx.NewSelect().
+				Model((*models.WaitlistEntry)(nil)).
+				Column("event_id").
+				Where("status = ?", models.WaitlistStatusOffered).
+				Where("expires_at <= ?", now)).
+			Order("event_id").
+			For("UPDATE").
+			Scan(ctx, &eventIDs)
+		if err != nil {
+			return fmt.Errorf("error locking events with expired offers: %w", err)
+		}
+		if len(eventIDs) == 0 {
+			return nil
+		}
+
+		_, err = tx.NewUpdate().
+			Model(&expired).
+			Set("status = ?", models.WaitlistStatusExpired).
+			Where("event_id IN (?)", bun.In(eventIDs)).
+			Where("status = ?", models.WaitlistStatusOffered).
+			Where("expires_at <= ?", now).
+			Returning("*").
+			Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("error expiring waitlist offers: %w", err)
+		}
+
+		for _, eventID := range eventIDs {
+			promoted, err := promoteWaitlist(ctx, tx, eventID)
+			if err != nil {
+				return err
+			}
+			promotions = append(promotions, promoted...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return expired, promotions, nil
+}
+
+// PromoteAllWaitlists fills free seats of every event with a waitlist, used by the scheduler
+func PromoteAllWaitlists(ctx context.Context) ([]models.WaitlistEntry, error) {
+	var eventIDs []int
+	err := Db_GlobalVar.NewSelect().
+		Model((*models.WaitlistEntry)(nil)).
+		ColumnExpr("DISTINCT event_id").
+		Where("status = ?", models.WaitlistStatusWaiting).
+		Scan(ctx, &eventIDs)
+	if err != nil {
+		return nil, fmt.Errorf("error listing events with a waitlist: %w", err)
+	}
+
+	var promotions []models.WaitlistEntry
+	for _, eventID := range eventIDs {
+		promoted, err := PromoteWaitlist(ctx, eventID)
+		if err != nil {
+			return promotions, err
+		}
+		promotions = append(promotions, promoted...)
+	}
+	return promotions, nil
+}
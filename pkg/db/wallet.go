@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"eventy/pkg/models"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+)
+
+var (
+	ErrInvalidAmount  = errors.New("amount must not be zero")
+	ErrWalletCurrency = errors.New("event is not priced in the wallet currency")
+)
+
+// PostWalletTransaction appends an entry to the wallet ledger and moves the balance with it
+func PostWalletTransaction(ctx context.Context, entry *models.WalletTransaction) error {
+	return Db_GlobalVar.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		return postWalletTransaction(ctx, tx, entry)
+	})
+}
+
+// postWalletTransaction appends a ledger entry inside the caller transaction.
+// The user row is locked and a debit that would overdraw the wallet is rejected.
+func postWalletTransaction(ctx context.Context, tx bun.Tx, entry *models.WalletTransaction) error {
+	if entry.Amount == 0 {
+		return ErrInvalidAmount
+	}
+
+	var user models.User
+	err := tx.NewSelect().
+		Model(&user).
+		Column("user_id", "balance").
+		Where("user_id = ?", entry.UserID).
+		For("UPDATE").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error fetching user with ID %d: %w", entry.UserID, err)
+	}
+
+	balance := user.Balance + entry.Amount
+	if balance < 0 {
+		log.Warn().Msgf("User %d balance %d cannot cover a debit of %d", entry.UserID, user.Balance, -entry.Amount)
+		return ErrInsufficientBalance
+	}
+
+	_, err = tx.NewUpdate().
+		Model((*models.User)(nil)).
+		Set("balance = ?", balance).
+		Where("user_id = ?", entry.UserID).
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("error updating balance of user with ID %d: %w", entry.UserID, err)
+	}
+
+	entry.TxID = 0
+	entry.BalanceAfter = balance
+	if _, err := tx.NewInsert().Model(entry).Exec(ctx); err != nil {
+		return fmt.Errorf("error recording wallet transaction: %w", err)
+	}
+
+	log.Debug().Msgf("Wallet of user %d: %+d (%s %s), balance %d", entry.UserID, entry.Amount, entry.RefType, entry.RefID, balance)
+	return nil
+}
+
+// GetWalletTransactions retrieves the ledger of a user, newest first
+func GetWalletTransactions(ctx context.Context, userID, limit, offset int) ([]models.WalletTransaction, error) {
+	var entries []models.WalletTransaction
+	q := Db_GlobalVar.NewSelect().
+		Model(&entries).
+		Where("user_id = ?", userID).
+		Order("tx_id DESC")
+	if limit > 0 {
+		q = q.Limit(limit).Offset(offset)
+	}
+
+	if err := q.Scan(ctx); err != nil {
+		return nil, fmt.Errorf("error getting wallet transactions of user with ID %d: %w", userID, err)
+	}
+	return entries, nil
+}
+
+// GetLedgerBalance returns the balance derived from the ledger, it matches user.balance
+func GetLedgerBalance(ctx context.Context, userID int) (int, error) {
+	var balance int
+	err := Db_GlobalVar.NewSelect().
+		Model((*models.WalletTransaction)(nil)).
+		ColumnExpr("COALESCE(SUM(amount), 0)").
+		Where("user_id = ?", userID).
+		Scan(ctx, &balance)
+	if err != nil {
+		return 0, fmt.Errorf("error summing wallet of user with ID %d: %w", userID, err)
+	}
+	return balance, nil
+}
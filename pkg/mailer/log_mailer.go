@@ -0,0 +1,60 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// LogMailer writes emails to the application log and, when a path is set, appends them to a file.
+// It is meant for local development and tests.
+type LogMailer struct {
+	Path string
+	mu   sync.Mutex
+	sent []Message
+}
+
+func NewLogMailer(path string) *LogMailer {
+	return &LogMailer{Path: path}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, msg)
+	log.Info().Str("To", msg.To).Str("Subject", msg.Subject).Msg("Mail (log driver)")
+
+	if m.Path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.Path), os.ModePerm); err != nil {
+		return fmt.Errorf("error creating mail log directory: %w", err)
+	}
+
+	f, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("error opening mail log file: %w", err)
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "----- %s -----\nTo: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().Format("2006-01-02 15:04:05"), msg.To, msg.Subject, msg.Body)
+	return err
+}
+
+// Sent returns a copy of every message sent through this mailer
+func (m *LogMailer) Sent() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]Message, len(m.sent))
+	copy(out, m.sent)
+	return out
+}
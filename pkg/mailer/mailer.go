@@ -0,0 +1,73 @@
+package mailer
+
+import (
+	"context"
+	"eventy/config"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Message is an outgoing plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails, implementations are selected with MAIL_DRIVER
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+var (
+	mu      sync.RWMutex
+	current Mailer = NewLogMailer("")
+)
+
+// Init selects the mailer from the loaded config
+func Init() error {
+	m, err := New(config.Configvar.Mail.Driver)
+	if err != nil {
+		return err
+	}
+	SetMailer(m)
+	log.Info().Str("Driver", config.Configvar.Mail.Driver).Msg("Mailer configured")
+	return nil
+}
+
+// New builds the mailer for the given driver name
+func New(driver string) (Mailer, error) {
+	cfg := config.Configvar.Mail
+
+	switch strings.ToLower(driver) {
+	case "", "log":
+		return NewLogMailer(cfg.LogFile), nil
+	case "smtp":
+		return NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUser, cfg.SMTPPassword, cfg.From), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver: %s", driver)
+	}
+}
+
+// SetMailer replaces the mailer used by Send, mainly for tests
+func SetMailer(m Mailer) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = m
+}
+
+// Send delivers msg with the configured mailer
+func Send(ctx context.Context, msg Message) error {
+	mu.RLock()
+	m := current
+	mu.RUnlock()
+
+	if err := m.Send(ctx, msg); err != nil {
+		log.Err(err).Str("To", msg.To).Str("Subject", msg.Subject).Msg("Error sending mail")
+		return err
+	}
+	return nil
+}
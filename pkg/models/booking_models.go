@@ -0,0 +1,91 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+////////// THIS FILE REPRESENT STRCTS FOR BOOKING TABLE //////////
+
+// Booking statuses
+const (
+	BookingStatusPending   = "pending" // seat held until the card payment succeeds
+	BookingStatusConfirmed = "confirmed"
+	BookingStatusCancelled = "cancelled"
+)
+
+// BookingActiveStatuses are the statuses of attendees of the event
+var BookingActiveStatuses = []string{BookingStatusConfirmed}
+
+// BookingHeldStatuses are the statuses holding a seat of the event
+var BookingHeldStatuses = []string{BookingStatusPending, BookingStatusConfirmed}
+
+// Payment reference of bookings paid from the wallet balance,
+// bookings paid by card carry the provider reference of the payment instead
+const PaymentRefWallet = "wallet"
+
+// Refund method of money given back through the card payment provider
+const RefundMethodCard = "card"
+
+type Booking struct {
+	bun.BaseModel `json:"-" bun:"table:booking"`
+	BookingID     int        `bun:"booking_id,autoincrement,pk" json:"booking_id"`
+	UserID        int        `bun:"user_id,notnull" json:"user_id"`
+	EventID       int        `bun:"event_id,notnull" json:"event_id"`
+	Status        string     `bun:"status,notnull" json:"status"`
+	Seats         int        `bun:"seats,notnull,default:1" json:"seats"`
+	Attendees     []Attendee `bun:"attendees,type:jsonb" json:"attendees,omitempty"` // named by the purchaser, in ticket order
+	PricePaid     int        `bun:"price_paid,notnull" json:"price_paid"`            // for all the seats
+	PaymentRef    string     `bun:"payment_ref" json:"payment_ref"`
+	TicketTypeID  int        `bun:"ticket_type_id,nullzero" json:"ticket_type_id,omitempty"`
+	PromoID       int        `bun:"promo_id,nullzero" json:"promo_id,omitempty"`
+	PromoCode     string     `bun:"promo_code" json:"promo_code,omitempty"`
+	Discount      int        `bun:"discount,notnull,default:0" json:"discount"` // taken off the price by the promo code
+	CreatedAt     time.Time  `bun:"created_at,nullzero,notnull,default:current_timestamp" json:"created_at"`
+	CancelledAt   *time.Time `bun:"cancelled_at" json:"cancelled_at"`
+}
+
+// Attendee is a guest of a group booking, both fields are optional
+type Attendee struct {
+	Name  string `json:"name"`
+	Email string `json:"email" binding:"omitempty,email"`
+}
+
+// Refund statuses, wallet refunds succeed immediately while card refunds wait for the provider
+const (
+	RefundStatusPending   = "pending"
+	RefundStatusSucceeded = "succeeded"
+	RefundStatusFailed    = "failed"
+)
+
+// Refund is the audit record of money given back for a booking
+type Refund struct {
+	bun.BaseModel `json:"-" bun:"table:refund"`
+	RefundID      int       `bun:"refund_id,autoincrement,pk" json:"refund_id"`
+	BookingID     int       `bun:"booking_id,notnull" json:"booking_id"`
+	UserID        int       `bun:"user_id,notnull" json:"user_id"`
+	EventID       int       `bun:"event_id,notnull" json:"event_id"`
+	Amount        int       `bun:"amount,notnull" json:"amount"`
+	Percent       int       `bun:"percent,notnull" json:"percent"`
+	Method        string    `bun:"method,notnull" json:"method"`
+	Status        string    `bun:"status,notnull,default:'succeeded'" json:"status"`
+	PaymentID     int       `bun:"payment_id,nullzero" json:"payment_id,omitempty"` // card payment refunded
+	ProviderRef   string    `bun:"provider_ref" json:"provider_ref,omitempty"`      // refund ID at the provider
+	FailureReason string    `bun:"failure_reason" json:"failure_reason,omitempty"`  // last provider error
+	Attempts      int       `bun:"attempts,notnull,default:0" json:"attempts"`      // retries after a failure, part of the idempotency key
+	Reason        string    `bun:"reason" json:"reason"`
+	Actor         string    `bun:"actor,notnull" json:"actor"`
+	CreatedAt     time.Time `bun:"created_at,nullzero,notnull,default:current_timestamp" json:"created_at"`
+}
+
+// RefundBookingRequest refunds part of a booking without cancelling it
+type RefundBookingRequest struct {
+	Amount int    `json:"amount" binding:"required,gt=0"`
+	Reason string `json:"reason" binding:"required"`
+}
+
+type CancelBookingRequest struct {
+	Reason     string `json:"reason"`
+	FullRefund bool   `json:"full_refund"` // back-office only, overrides the event policy
+}
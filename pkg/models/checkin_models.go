@@ -0,0 +1,89 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+////////// THIS FILE REPRESENT STRCTS FOR CHECK_IN TABLE //////////
+
+// Where a check-in was recorded
+const (
+	CheckInSourceOnline  = "online"  // scanned against the server
+	CheckInSourceOffline = "offline" // scanned against a manifest and uploaded later
+)
+
+// CheckIn records the entry of a ticket holder, a ticket is checked in once
+type CheckIn struct {
+	bun.BaseModel `json:"-" bun:"table:check_in"`
+	CheckInID     int       `bun:"check_in_id,autoincrement,pk" json:"check_in_id"`
+	TicketID      int       `bun:"ticket_id,notnull,unique" json:"ticket_id"`
+	EventID       int       `bun:"event_id,notnull" json:"event_id"`
+	BookingID     int       `bun:"booking_id,notnull" json:"booking_id"`
+	UserID        int       `bun:"user_id,notnull" json:"user_id"`
+	Gate          string    `bun:"gate" json:"gate"`
+	Staff         string    `bun:"staff,notnull" json:"staff"` // actor of the scanner, e.g. "operator:alice"
+	Source        string    `bun:"source,nullzero,notnull,default:'online'" json:"source"`
+	DeviceID      string    `bun:"device_id" json:"device_id,omitempty"`
+	CheckedInAt   time.Time `bun:"checked_in_at,notnull" json:"checked_in_at"` // scan time, the earliest scan wins
+}
+
+// CheckInRequest is a scanned ticket, either its signed QR payload or its code typed by the staff
+type CheckInRequest struct {
+	EventID   int    `json:"event_id" binding:"required"`
+	QRPayload string `json:"qr_payload"`
+	Code      string `json:"code"`
+	Gate      string `json:"gate"`
+}
+
+// CheckInStats compares the attendees checked in with the valid tickets of an event
+type CheckInStats struct {
+	EventID   int            `json:"event_id"`
+	Booked    int            `json:"booked"` // valid tickets
+	CheckedIn int            `json:"checked_in"`
+	Remaining int            `json:"remaining"`
+	ByGate    map[string]int `json:"by_gate"`
+}
+
+// CheckInManifest lists the ticket codes a scanner accepts offline for an event.
+// Signature is the HMAC of the manifest with the ticket signing key, see ticket.ManifestMessage.
+type CheckInManifest struct {
+	EventID     int       `json:"event_id"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Codes       []string  `json:"codes"`      // valid tickets, sorted
+	CheckedIn   []string  `json:"checked_in"` // codes among them already checked in
+	Signature   string    `json:"signature"`
+}
+
+// OfflineCheckIn is a ticket scanned by a device without connectivity
+type OfflineCheckIn struct {
+	Code      string    `json:"code" binding:"required"`
+	Gate      string    `json:"gate"`
+	ScannedAt time.Time `json:"scanned_at" binding:"required"`
+}
+
+// SyncCheckInsRequest uploads the check-ins a device recorded offline
+type SyncCheckInsRequest struct {
+	EventID  int              `json:"event_id" binding:"required"`
+	DeviceID string           `json:"device_id" binding:"required"`
+	CheckIns []OfflineCheckIn `json:"check_ins" binding:"required,dive"`
+}
+
+// Reasons an offline check-in was not recorded as uploaded
+const (
+	CheckInConflictDuplicate   = "duplicate"    // the ticket was scanned more than once, the earliest scan is kept
+	CheckInConflictNotFound    = "not_found"    // unknown code
+	CheckInConflictWrongEvent  = "wrong_event"  // the ticket is for another event
+	CheckInConflictVoid        = "void"         // the booking was cancelled
+	CheckInConflictUnavailable = "unavailable"  // the event was cancelled
+	CheckInConflictInvalidTime = "invalid_time" // scanned in the future
+)
+
+// CheckInConflict reports an uploaded scan that was not recorded as is
+type CheckInConflict struct {
+	Code      string    `json:"code"`
+	ScannedAt time.Time `json:"scanned_at"`
+	Reason    string    `json:"reason"`
+	Kept      *CheckIn  `json:"kept,omitempty"` // check-in kept for a duplicate
+}
@@ -1,9 +1,20 @@
 package models
 
-import "github.com/uptrace/bun"
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
 
 ////////// THIS FILE REPRESENT STRCTS FOR EVENT TABLE //////////
 
+// Event statuses, decided at the MinCapacity deadline
+const (
+	EventStatusScheduled = "scheduled" // not decided yet
+	EventStatusConfirmed = "confirmed" // MinCapacity was reached at the deadline
+	EventStatusCancelled = "cancelled" // below MinCapacity at the deadline, attendees were refunded
+)
+
 type Event struct {
 	bun.BaseModel `json:"-" bun:"table:event"`
 	EventID       int    `bun:"event_id,autoincrement,pk" json:"event_id" `
@@ -17,21 +28,45 @@ type Event struct {
 	MaxCapacity   int    `bun:"max_capacity" json:"max_capacity" binding:"required"`
 	IsArchived    bool   `bun:"isArchived" json:"isArchived"`
 	Price         int    `bun:"price" json:"price" binding:"required"`
-	UserID        []int  `bun:"user_id,array" json:"user_id" `
+	Currency      string `bun:"currency" json:"currency,omitempty"` // defaults to PAYMENT_CURRENCY
+	// Cancellation policy: full refund up to RefundFullDays before the start date,
+	// RefundPartialPercent of the price after that, nothing on the day of the event
+	RefundFullDays       int          `bun:"refund_full_days,notnull,default:0" json:"refund_full_days"`
+	RefundPartialPercent int          `bun:"refund_partial_percent,notnull,default:0" json:"refund_partial_percent"`
+	Status               string       `bun:"status,nullzero,notnull,default:'scheduled'" json:"status"` // set by the system only
+	DecidedAt            *time.Time   `bun:"decided_at" json:"decided_at,omitempty"`
+	UserID               []int        `bun:"user_id,array,scanonly" json:"user_id"` // users holding an active booking
+	TicketTypes          []TicketType `bun:"-" json:"ticket_types,omitempty"`       // price tiers with their remaining stock
 }
 
 type EventNoBind struct {
-	bun.BaseModel `json:"-" bun:"table:event"`
-	EventID       int    `bun:"event_id,autoincrement,pk" json:"event_id" `
-	Title         string `bun:"title" json:"title"`
-	StartDate     string `bun:"start_date" json:"start_date"`
-	EndDate       string `bun:"end_date" json:"end_date"`
-	Location      string `bun:"location" json:"location"`
-	Image         string `bun:"image,type:bytea" json:"image"`
-	MinCapacity   int    `bun:"min_capacity" json:"min_capacity"`
-	MaxCapacity   int    `bun:"max_capacity" json:"max_capacity"`
-	IsArchived    bool   `bun:"isArchived" json:"isArchived"`
-	Category      int    `bun:"category" json:"category"`
-	Price         int    `bun:"price" json:"price"`
-	UserID        []int  `bun:"user_id,array" json:"user_id" `
+	bun.BaseModel        `json:"-" bun:"table:event"`
+	EventID              int        `bun:"event_id,autoincrement,pk" json:"event_id" `
+	Title                string     `bun:"title" json:"title"`
+	StartDate            string     `bun:"start_date" json:"start_date"`
+	EndDate              string     `bun:"end_date" json:"end_date"`
+	Location             string     `bun:"location" json:"location"`
+	Image                string     `bun:"image,type:bytea" json:"image"`
+	MinCapacity          int        `bun:"min_capacity" json:"min_capacity"`
+	MaxCapacity          int        `bun:"max_capacity" json:"max_capacity"`
+	IsArchived           bool       `bun:"isArchived" json:"isArchived"`
+	Category             int        `bun:"category" json:"category"`
+	Price                int        `bun:"price" json:"price"`
+	RefundFullDays       int        `bun:"refund_full_days,notnull,default:0" json:"refund_full_days"`
+	RefundPartialPercent int        `bun:"refund_partial_percent,notnull,default:0" json:"refund_partial_percent"`
+	Status               string     `bun:"status,nullzero,notnull,default:'scheduled'" json:"status"`
+	DecidedAt            *time.Time `bun:"decided_at" json:"decided_at,omitempty"`
+	UserID               []int      `bun:"user_id,array,scanonly" json:"user_id"` // users holding an active booking
+}
+
+// EventAtRisk is an undecided event whose bookings are still below MinCapacity
+type EventAtRisk struct {
+	EventID     int       `bun:"event_id" json:"event_id"`
+	Title       string    `bun:"title" json:"title"`
+	StartDate   string    `bun:"start_date" json:"start_date"`
+	MinCapacity int       `bun:"min_capacity" json:"min_capacity"`
+	MaxCapacity int       `bun:"max_capacity" json:"max_capacity"`
+	Booked      int       `bun:"booked" json:"booked"`
+	Missing     int       `bun:"-" json:"missing"`     // bookings still needed to reach MinCapacity
+	DecisionAt  time.Time `bun:"-" json:"decision_at"` // when the event is confirmed or cancelled
 }
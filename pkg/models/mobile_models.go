@@ -1,6 +1,16 @@
 package models
 
 type BookEventRequest struct {
-	EventID int `json:"event_id" binding:"required"`
-	UserID  int `json:"user_id" binding:"required"`
+	EventID      int        `json:"event_id" binding:"required"`
+	UserID       int        `json:"user_id"`        // optional, must match the authenticated user
+	TicketTypeID int        `json:"ticket_type_id"` // required for events with ticket types
+	PromoCode    string     `json:"promo_code"`
+	Seats        int        `json:"seats" binding:"omitempty,gte=1"` // defaults to one seat
+	Attendees    []Attendee `json:"attendees" binding:"omitempty,dive"`
+}
+
+// ReassignTicketRequest hands a ticket of a group booking to another attendee
+type ReassignTicketRequest struct {
+	Name  string `json:"name"`
+	Email string `json:"email" binding:"omitempty,email"`
 }
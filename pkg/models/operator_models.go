@@ -0,0 +1,30 @@
+package models
+
+import "github.com/uptrace/bun"
+
+////////// THIS FILE REPRESENT STRCTS FOR OPERATOR TABLE //////////
+
+// Operator is a back-office account, the password is stored as a bcrypt hash
+type Operator struct {
+	bun.BaseModel `json:"-" bun:"table:operator"`
+	OperatorID    int    `bun:"operator_id,autoincrement,pk" json:"operator_id"`
+	Username      string `bun:"username,unique,notnull" json:"username"`
+	Password      string `bun:"password,notnull" json:"-"`
+	Role          string `bun:"role,notnull" json:"role"`
+	IsDisabled    bool   `bun:"is_disabled" json:"is_disabled"`
+	TokenVersion  int    `bun:"token_version,notnull,default:0" json:"-"` // bumped on every change, older tokens are refused
+}
+
+type OperatorRequest struct {
+	Username   string `json:"username" binding:"required"`
+	Password   string `json:"password" binding:"required"`
+	Role       string `json:"role" binding:"required"`
+	IsDisabled bool   `json:"is_disabled"`
+}
+
+type OperatorUpdateRequest struct {
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	Role       string `json:"role"`
+	IsDisabled *bool  `json:"is_disabled"`
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+////////// THIS FILE REPRESENT STRCTS FOR PAYMENT TABLES //////////
+
+// What a payment is for
+const (
+	PaymentPurposeBooking = "booking" // BookingID is the pending booking
+	PaymentPurposeTopup   = "topup"   // credits the wallet once succeeded
+)
+
+// Payment statuses
+const (
+	PaymentStatusPending           = "pending"
+	PaymentStatusSucceeded         = "succeeded"
+	PaymentStatusFailed            = "failed"
+	PaymentStatusPartiallyRefunded = "partially_refunded"
+	PaymentStatusRefunded          = "refunded"
+)
+
+// Payment tracks a card payment from its creation to the provider outcome
+type Payment struct {
+	bun.BaseModel  `json:"-" bun:"table:payment"`
+	PaymentID      int        `bun:"payment_id,autoincrement,pk" json:"payment_id"`
+	Provider       string     `bun:"provider,notnull" json:"provider"`
+	ProviderRef    string     `bun:"provider_ref,notnull,unique" json:"provider_ref"` // e.g. the Stripe PaymentIntent ID
+	Purpose        string     `bun:"purpose,notnull" json:"purpose"`
+	UserID         int        `bun:"user_id,notnull" json:"user_id"`
+	EventID        int        `bun:"event_id,nullzero" json:"event_id,omitempty"`
+	BookingID      int        `bun:"booking_id,nullzero" json:"booking_id,omitempty"`
+	Amount         int        `bun:"amount,notnull" json:"amount"`
+	Currency       string     `bun:"currency,notnull" json:"currency"`
+	Status         string     `bun:"status,notnull" json:"status"`
+	AmountRefunded int        `bun:"amount_refunded,notnull,default:0" json:"amount_refunded"`
+	FailureReason  string     `bun:"failure_reason" json:"failure_reason,omitempty"`
+	CreatedAt      time.Time  `bun:"created_at,nullzero,notnull,default:current_timestamp" json:"created_at"`
+	CompletedAt    *time.Time `bun:"completed_at" json:"completed_at,omitempty"`
+}
+
+// PaymentEventKind is the provider-independent outcome carried by a webhook
+type PaymentEventKind string
+
+const (
+	PaymentEventSucceeded PaymentEventKind = "succeeded"
+	PaymentEventFailed    PaymentEventKind = "failed"
+	PaymentEventRefunded  PaymentEventKind = "refunded"
+)
+
+// PaymentEvent is a verified provider notification about a payment
+type PaymentEvent struct {
+	ID             string // provider event ID, processing is idempotent on it
+	Type           string // provider event type, e.g. payment_intent.succeeded
+	Kind           PaymentEventKind
+	ProviderRef    string
+	Amount         int    // amount received, for succeeded events
+	Currency       string // currency of Amount, for succeeded events
+	AmountRefunded int    // total refunded so far, for refunded events
+	FailureReason  string
+}
+
+// WebhookEvent records every processed provider event
+type WebhookEvent struct {
+	bun.BaseModel `json:"-" bun:"table:webhook_event"`
+	EventID       string    `bun:"event_id,pk" json:"event_id"`
+	Provider      string    `bun:"provider,notnull" json:"provider"`
+	Type          string    `bun:"type,notnull" json:"type"`
+	ProviderRef   string    `bun:"provider_ref" json:"provider_ref"`
+	ReceivedAt    time.Time `bun:"received_at,nullzero,notnull,default:current_timestamp" json:"received_at"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+////////// THIS FILE REPRESENT STRCTS FOR PROMO_CODE TABLE //////////
+
+// How a promo code lowers the price
+const (
+	PromoDiscountPercent = "percent" // DiscountValue percent of the price
+	PromoDiscountFixed   = "fixed"   // DiscountValue in the smallest currency unit
+)
+
+// PromoCode is a discount entered by the user when booking an event.
+// Without EventIDs and CategoryIDs it applies to every event, otherwise to the listed ones.
+type PromoCode struct {
+	bun.BaseModel  `json:"-" bun:"table:promo_code"`
+	PromoID        int        `bun:"promo_id,autoincrement,pk" json:"promo_id"`
+	Code           string     `bun:"code,notnull,unique" json:"code" binding:"required"` // stored upper-case
+	Description    string     `bun:"description" json:"description"`
+	DiscountType   string     `bun:"discount_type,notnull" json:"discount_type" binding:"required,oneof=percent fixed"`
+	DiscountValue  int        `bun:"discount_value,notnull" json:"discount_value" binding:"required,gt=0"`
+	EventIDs       []int      `bun:"event_ids,array" json:"event_ids"`
+	CategoryIDs    []int      `bun:"category_ids,array" json:"category_ids"`
+	MaxRedemptions int        `bun:"max_redemptions,notnull,default:0" json:"max_redemptions"` // 0 is unlimited
+	PerUserLimit   int        `bun:"per_user_limit,notnull,default:0" json:"per_user_limit"`   // 0 is unlimited
+	ValidFrom      *time.Time `bun:"valid_from" json:"valid_from"`
+	ValidUntil     *time.Time `bun:"valid_until" json:"valid_until"`
+	IsActive       bool       `bun:"is_active,notnull" json:"is_active"`
+	Redemptions    int        `bun:"redemptions,scanonly" json:"redemptions"` // bookings holding a seat with the code
+	CreatedAt      time.Time  `bun:"created_at,nullzero,notnull,default:current_timestamp" json:"created_at"`
+}
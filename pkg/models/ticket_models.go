@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+////////// THIS FILE REPRESENT STRCTS FOR TICKET TABLE //////////
+
+// Ticket statuses
+const (
+	TicketStatusValid = "valid"
+	TicketStatusVoid  = "void" // the booking was cancelled
+)
+
+// Ticket is the proof of a seat of a confirmed booking shown at the door, the purchaser
+// holds the tickets of all the attendees of a group booking
+type Ticket struct {
+	bun.BaseModel `json:"-" bun:"table:ticket"`
+	TicketID      int        `bun:"ticket_id,autoincrement,pk" json:"ticket_id"`
+	BookingID     int        `bun:"booking_id,notnull" json:"booking_id"`
+	EventID       int        `bun:"event_id,notnull" json:"event_id"`
+	UserID        int        `bun:"user_id,notnull" json:"user_id"`
+	Code          string     `bun:"code,notnull,unique" json:"code"`
+	Status        string     `bun:"status,notnull" json:"status"`
+	AttendeeName  string     `bun:"attendee_name" json:"attendee_name,omitempty"`
+	AttendeeEmail string     `bun:"attendee_email" json:"attendee_email,omitempty"`
+	IssuedAt      time.Time  `bun:"issued_at,nullzero,notnull,default:current_timestamp" json:"issued_at"`
+	VoidedAt      *time.Time `bun:"voided_at" json:"voided_at,omitempty"`
+	QRPayload     string     `bun:"-" json:"qr_payload,omitempty"` // signed content of the QR code
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+////////// THIS FILE REPRESENT STRCTS FOR TICKET_TYPE TABLE //////////
+
+// TicketType is a price tier of an event, e.g. early bird, standard, VIP or student.
+// An event with ticket types is booked through one of them, the quotas sum to at most MaxCapacity.
+type TicketType struct {
+	bun.BaseModel `json:"-" bun:"table:ticket_type"`
+	TicketTypeID  int        `bun:"ticket_type_id,autoincrement,pk" json:"ticket_type_id"`
+	EventID       int        `bun:"event_id,notnull" json:"event_id" binding:"required"`
+	Name          string     `bun:"name,notnull" json:"name" binding:"required"`
+	Price         int        `bun:"price,notnull" json:"price" binding:"gte=0"`
+	Quota         int        `bun:"quota,notnull" json:"quota" binding:"required,gt=0"`
+	SalesStart    *time.Time `bun:"sales_start" json:"sales_start"`
+	SalesEnd      *time.Time `bun:"sales_end" json:"sales_end"`
+	Sold          int        `bun:"sold,scanonly" json:"sold"` // bookings holding a seat of this type
+	Remaining     int        `bun:"-" json:"remaining"`
+	OnSale        bool       `bun:"-" json:"on_sale"`
+	CreatedAt     time.Time  `bun:"created_at,nullzero,notnull,default:current_timestamp" json:"created_at"`
+}
+
+// IsOnSale reports whether the sale window of the type is open at the given time
+func (t *TicketType) IsOnSale(now time.Time) bool {
+	return (t.SalesStart == nil || !now.Before(*t.SalesStart)) &&
+		(t.SalesEnd == nil || now.Before(*t.SalesEnd))
+}
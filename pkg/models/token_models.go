@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+////////// THIS FILE REPRESENT STRCTS FOR REFRESH TOKEN TABLE //////////
+
+// RefreshToken is one link of a rotating refresh token chain, tokens of the same login share a FamilyID
+type RefreshToken struct {
+	bun.BaseModel `json:"-" bun:"table:refresh_token"`
+	TokenID       int        `bun:"token_id,autoincrement,pk" json:"token_id"`
+	TokenHash     string     `bun:"token_hash,unique,notnull" json:"-"`
+	FamilyID      string     `bun:"family_id,notnull" json:"family_id"`
+	UserID        int        `bun:"user_id,notnull" json:"user_id"`
+	CreatedAt     time.Time  `bun:"created_at,nullzero,notnull,default:current_timestamp" json:"created_at"`
+	ExpiresAt     time.Time  `bun:"expires_at,notnull" json:"expires_at"`
+	RevokedAt     *time.Time `bun:"revoked_at" json:"revoked_at"`
+	ReplacedBy    int        `bun:"replaced_by,nullzero" json:"replaced_by"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// Purposes of single-use user tokens
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+)
+
+// UserToken is a single-use, expiring token sent by email (password reset, email verification)
+type UserToken struct {
+	bun.BaseModel `json:"-" bun:"table:user_token"`
+	TokenID       int        `bun:"token_id,autoincrement,pk" json:"token_id"`
+	TokenHash     string     `bun:"token_hash,unique,notnull" json:"-"`
+	UserID        int        `bun:"user_id,notnull" json:"user_id"`
+	Purpose       string     `bun:"purpose,notnull" json:"purpose"`
+	CreatedAt     time.Time  `bun:"created_at,nullzero,notnull,default:current_timestamp" json:"created_at"`
+	ExpiresAt     time.Time  `bun:"expires_at,notnull" json:"expires_at"`
+	UsedAt        *time.Time `bun:"used_at" json:"used_at"`
+}
+
+type PasswordResetRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type PasswordResetConfirm struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+type EmailVerificationConfirm struct {
+	Token string `json:"token" binding:"required"`
+}
@@ -1,6 +1,10 @@
 package models
 
-import "github.com/uptrace/bun"
+import (
+	"encoding/json"
+
+	"github.com/uptrace/bun"
+)
 
 ////////// THIS FILE REPRESENT STRCTS FOR USER TABLE //////////
 
@@ -11,9 +15,18 @@ type User struct {
 	Password      string `bun:"password" json:"password" binding:"required"`
 	Name          string `bun:"name" json:"name" binding:"required"`
 	Is_guest      bool   `bun:"is_guest" json:"is_guest"`
-	EventID       []int  `bun:"event_id" json:"event_id"`
-	BookedEvents  []int  `bun:"booked_events" json:"booked_events"`
-	Balance       int    `bun:"balance" json:"balance"`
+	EmailVerified bool   `bun:"email_verified,notnull,default:false" json:"email_verified"`
+	EventID       []int  `bun:"event_id,array,scanonly" json:"event_id"` // events with an active booking
+	Balance       int    `bun:"balance,notnull,default:0" json:"balance"`
+}
+
+// MarshalJSON never exposes the password hash in API responses
+func (u User) MarshalJSON() ([]byte, error) {
+	type user User
+	return json.Marshal(struct {
+		user
+		Password string `json:"password,omitempty"`
+	}{user: user(u)})
 }
 
 type Login struct {
@@ -21,3 +34,8 @@ type Login struct {
 	Email         string `bun:"email,pk" json:"email" binding:"required"`
 	Password      string `bun:"password" json:"password" binding:"required"`
 }
+
+type BackofficeLogin struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+////////// THIS FILE REPRESENT STRCTS FOR WAITLIST TABLE //////////
+
+// Waitlist entry statuses
+const (
+	WaitlistStatusWaiting  = "waiting"  // in the queue
+	WaitlistStatusOffered  = "offered"  // a seat is held until ExpiresAt, the user must book to confirm
+	WaitlistStatusPromoted = "promoted" // booked, see BookingID
+	WaitlistStatusExpired  = "expired"  // the offer was not confirmed in time
+	WaitlistStatusLeft     = "left"     // the user left the waitlist
+)
+
+type WaitlistEntry struct {
+	bun.BaseModel `json:"-" bun:"table:waitlist"`
+	EntryID       int        `bun:"entry_id,autoincrement,pk" json:"entry_id"`
+	EventID       int        `bun:"event_id,notnull" json:"event_id"`
+	UserID        int        `bun:"user_id,notnull" json:"user_id"`
+	Status        string     `bun:"status,notnull" json:"status"`
+	CreatedAt     time.Time  `bun:"created_at,nullzero,notnull,default:current_timestamp" json:"created_at"`
+	OfferedAt     *time.Time `bun:"offered_at" json:"offered_at,omitempty"`
+	ExpiresAt     *time.Time `bun:"expires_at" json:"expires_at,omitempty"`
+	BookingID     int        `bun:"booking_id,nullzero" json:"booking_id,omitempty"`
+	Position      int        `bun:"position,scanonly" json:"position,omitempty"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+////////// THIS FILE REPRESENT STRCTS FOR WALLET_TRANSACTION TABLE //////////
+
+// What a wallet transaction refers to
+const (
+	WalletRefOpening    = "opening"    // balance held before the ledger existed
+	WalletRefBooking    = "booking"    // RefID is the booking ID
+	WalletRefRefund     = "refund"     // RefID is the refund ID
+	WalletRefPayment    = "payment"    // RefID is the payment provider reference
+	WalletRefAdjustment = "adjustment" // manual credit or debit by an operator
+)
+
+// WalletTransaction is an append-only ledger entry, the user balance is the sum of its entries
+type WalletTransaction struct {
+	bun.BaseModel `json:"-" bun:"table:wallet_transaction"`
+	TxID          int       `bun:"tx_id,autoincrement,pk" json:"tx_id"`
+	UserID        int       `bun:"user_id,notnull" json:"user_id"`
+	Amount        int       `bun:"amount,notnull" json:"amount"` // positive for credits, negative for debits
+	BalanceAfter  int       `bun:"balance_after,notnull" json:"balance_after"`
+	RefType       string    `bun:"ref_type,notnull" json:"ref_type"`
+	RefID         string    `bun:"ref_id" json:"ref_id,omitempty"`
+	Reason        string    `bun:"reason" json:"reason"`
+	Actor         string    `bun:"actor,notnull" json:"actor"`
+	CreatedAt     time.Time `bun:"created_at,nullzero,notnull,default:current_timestamp" json:"created_at"`
+}
+
+// TopupRequest credits the wallet once the card payment succeeds
+type TopupRequest struct {
+	Amount int `json:"amount" binding:"required,gt=0"` // smallest currency unit
+}
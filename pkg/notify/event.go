@@ -0,0 +1,50 @@
+package notify
+
+import (
+	"context"
+	"eventy/pkg/db"
+	"eventy/pkg/models"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+// EventDecisions tells attendees whether their event takes place, and waitlisted users when it does not
+func EventDecisions(ctx context.Context, decisions []db.EventDecision) {
+	for _, decision := range decisions {
+		switch decision.Status {
+		case models.EventStatusCancelled:
+			for _, refund := range decision.Refunds {
+				User(ctx, refund.UserID, "Eventy - event cancelled",
+					fmt.Sprintf("%s did not reach its minimum number of attendees and has been cancelled. %s",
+						decision.Title, refundNotice(refund.Method, refund.Amount)))
+			}
+			for _, entry := range decision.Waitlist {
+				User(ctx, entry.UserID, "Eventy - event cancelled",
+					fmt.Sprintf("%s did not reach its minimum number of attendees and has been cancelled. You were removed from its waitlist.",
+						decision.Title))
+			}
+		case models.EventStatusConfirmed:
+			bookings, err := db.GetBookingsByEvent(ctx, decision.EventID)
+			if err != nil {
+				log.Warn().Err(err).Int("EventID", decision.EventID).Msg("Cannot notify attendees")
+				continue
+			}
+			for _, booking := range bookings {
+				if booking.Status != models.BookingStatusConfirmed {
+					continue
+				}
+				User(ctx, booking.UserID, "Eventy - event confirmed",
+					fmt.Sprintf("%s reached its minimum number of attendees and will take place. See you there!", decision.Title))
+			}
+		}
+	}
+}
+
+// refundNotice tells where the money of a refund goes
+func refundNotice(method string, amount int) string {
+	if method == models.RefundMethodCard {
+		return fmt.Sprintf("%d is being refunded to the card you paid with.", amount)
+	}
+	return fmt.Sprintf("%d was refunded to your wallet.", amount)
+}
@@ -0,0 +1,37 @@
+package notify
+
+import (
+	"context"
+	"eventy/pkg/db"
+	"eventy/pkg/mailer"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+// User mails a user by ID, failures are only logged so they never undo the action that triggered them
+func User(ctx context.Context, userID int, subject, body string) {
+	user, err := db.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Warn().Err(err).Int("UserID", userID).Msg("Cannot notify user")
+		return
+	}
+
+	err = mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: subject,
+		Body:    fmt.Sprintf("Hello %s,\n\n%s\n", user.Name, body),
+	})
+	if err != nil {
+		log.Warn().Err(err).Int("UserID", userID).Str("Subject", subject).Msg("Failed to notify user")
+	}
+}
+
+// eventName returns the event name for messages, falling back to its ID
+func eventName(ctx context.Context, eventID int) string {
+	event, err := db.GetEventByID(ctx, eventID)
+	if err != nil {
+		return fmt.Sprintf("#%d", eventID)
+	}
+	return event.Title
+}
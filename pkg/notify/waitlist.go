@@ -0,0 +1,38 @@
+package notify
+
+import (
+	"context"
+	"eventy/pkg/models"
+	"fmt"
+	"time"
+)
+
+// WaitlistPromotions tells each user what a waitlist promotion means for them
+func WaitlistPromotions(ctx context.Context, entries []models.WaitlistEntry) {
+	for _, entry := range entries {
+		name := eventName(ctx, entry.EventID)
+		switch entry.Status {
+		case models.WaitlistStatusPromoted:
+			User(ctx, entry.UserID, "Eventy - you are in!",
+				fmt.Sprintf("A seat freed up for %s and you were booked from the waitlist (booking %d). The price was debited from your wallet.",
+					name, entry.BookingID))
+		case models.WaitlistStatusOffered:
+			expires := ""
+			if entry.ExpiresAt != nil {
+				expires = entry.ExpiresAt.Format(time.RFC1123)
+			}
+			User(ctx, entry.UserID, "Eventy - a seat is waiting for you",
+				fmt.Sprintf("A seat freed up for %s but your wallet balance does not cover the price. Top up and book the event before %s to keep the seat.",
+					name, expires))
+		}
+	}
+}
+
+// WaitlistExpired tells users their held seat was released
+func WaitlistExpired(ctx context.Context, entries []models.WaitlistEntry) {
+	for _, entry := range entries {
+		User(ctx, entry.UserID, "Eventy - your seat offer expired",
+			fmt.Sprintf("The seat held for you on %s was not confirmed in time and went to the next person on the waitlist.",
+				eventName(ctx, entry.EventID)))
+	}
+}
@@ -0,0 +1,217 @@
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"eventy/pkg/models"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+const ProviderFake = "fake"
+
+// Webhook event types understood by the fake provider
+const (
+	FakeEventSucceeded = "payment.succeeded"
+	FakeEventFailed    = "payment.failed"
+	FakeEventRefunded  = "payment.refunded"
+)
+
+var ErrUnknownIntent = errors.New("unknown payment intent")
+
+// FakeWebhook is the payload accepted by the fake provider webhook, for example
+//
+//	{"id": "evt_1", "type": "payment.succeeded", "ref": "fake_pi_1"}
+//
+// Amount and Currency default to those of the intent and AmountRefunded to the total refunded through Refund.
+// The Fake-Signature header must carry the hex HMAC-SHA256 of the payload with the webhook secret.
+type FakeWebhook struct {
+	ID             string `json:"id"`
+	Type           string `json:"type"`
+	Ref            string `json:"ref"`
+	Amount         int    `json:"amount,omitempty"`
+	Currency       string `json:"currency,omitempty"`
+	AmountRefunded int    `json:"amount_refunded,omitempty"`
+	FailureReason  string `json:"failure_reason,omitempty"`
+}
+
+// FakeProvider is an in-memory provider for local runs: nothing leaves the process and
+// payments complete when their signed webhook is posted. IDs are sequential and numbered
+// from seed, a database kept between runs needs a seed past the refs it already stores.
+type FakeProvider struct {
+	mu            sync.Mutex
+	seq           int64
+	intents       map[string]*Intent
+	refunded      map[string]int
+	refunds       map[string]*RefundResult // by idempotency key
+	webhookSecret string
+}
+
+func NewFakeProvider(webhookSecret string, seed int64) *FakeProvider {
+	return &FakeProvider{
+		seq:           seed,
+		intents:       make(map[string]*Intent),
+		refunded:      make(map[string]int),
+		refunds:       make(map[string]*RefundResult),
+		webhookSecret: webhookSecret,
+	}
+}
+
+func (f *FakeProvider) Name() string { return ProviderFake }
+
+func (f *FakeProvider) next(prefix string) string {
+	f.seq++
+	return fmt.Sprintf("%s_%d", prefix, f.seq)
+}
+
+func (f *FakeProvider) CreateIntent(_ context.Context, req IntentRequest) (*Intent, error) {
+	if req.Amount <= 0 {
+		return nil, fmt.Errorf("amount must be positive")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := f.next("fake_pi")
+	intent := &Intent{
+		ID:           id,
+		ClientSecret: id + "_secret",
+		Amount:       req.Amount,
+		Currency:     req.Currency,
+		Status:       "requires_payment_method",
+	}
+	f.intents[id] = intent
+
+	copied := *intent
+	return &copied, nil
+}
+
+func (f *FakeProvider) CancelIntent(_ context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	intent, ok := f.intents[id]
+	if !ok {
+		return ErrUnknownIntent
+	}
+	intent.Status = "canceled"
+	return nil
+}
+
+func (f *FakeProvider) Capture(_ context.Context, id string, amount int) (*Intent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	intent, ok := f.intents[id]
+	if !ok {
+		return nil, ErrUnknownIntent
+	}
+	if amount > 0 && amount < intent.Amount {
+		intent.Amount = amount
+	}
+	intent.Status = "succeeded"
+
+	copied := *intent
+	return &copied, nil
+}
+
+func (f *FakeProvider) Refund(_ context.Context, id string, req RefundRequest) (*RefundResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if done, ok := f.refunds[req.IdempotencyKey]; ok && req.IdempotencyKey != "" {
+		copied := *done
+		return &copied, nil
+	}
+
+	intent, ok := f.intents[id]
+	if !ok {
+		return nil, ErrUnknownIntent
+	}
+
+	amount := req.Amount
+	left := intent.Amount - f.refunded[id]
+	if amount <= 0 {
+		amount = left
+	}
+	if amount > left {
+		return nil, fmt.Errorf("refund of %d exceeds the %d left on %s", amount, left, id)
+	}
+	f.refunded[id] += amount
+
+	result := &RefundResult{ID: f.next("fake_re"), Amount: amount, Status: "succeeded"}
+	if req.IdempotencyKey != "" {
+		f.refunds[req.IdempotencyKey] = result
+	}
+	copied := *result
+	return &copied, nil
+}
+
+// Sign returns the Fake-Signature header value of a payload
+func (f *FakeProvider) Sign(payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(f.webhookSecret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (f *FakeProvider) ParseWebhook(payload []byte, header http.Header) (models.PaymentEvent, bool, error) {
+	// Unsigned webhooks are never accepted, they would confirm payments nobody made
+	if f.webhookSecret == "" || !hmac.Equal([]byte(header.Get("Fake-Signature")), []byte(f.Sign(payload))) {
+		return models.PaymentEvent{}, false, ErrInvalidSignature
+	}
+
+	var hook FakeWebhook
+	if err := json.Unmarshal(payload, &hook); err != nil {
+		return models.PaymentEvent{}, false, err
+	}
+	if hook.ID == "" || hook.Ref == "" {
+		return models.PaymentEvent{}, false, fmt.Errorf("id and ref are required")
+	}
+
+	event := models.PaymentEvent{
+		ID:             hook.ID,
+		Type:           hook.Type,
+		ProviderRef:    hook.Ref,
+		Amount:         hook.Amount,
+		Currency:       hook.Currency,
+		AmountRefunded: hook.AmountRefunded,
+		FailureReason:  hook.FailureReason,
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	intent := f.intents[hook.Ref]
+
+	switch hook.Type {
+	case FakeEventSucceeded:
+		event.Kind = models.PaymentEventSucceeded
+		if intent != nil {
+			if event.Amount == 0 {
+				event.Amount = intent.Amount
+			}
+			if event.Currency == "" {
+				event.Currency = intent.Currency
+			}
+			intent.Status = "succeeded"
+		}
+	case FakeEventFailed:
+		event.Kind = models.PaymentEventFailed
+		if event.FailureReason == "" {
+			event.FailureReason = "card declined"
+		}
+	case FakeEventRefunded:
+		event.Kind = models.PaymentEventRefunded
+		if event.AmountRefunded == 0 {
+			event.AmountRefunded = f.refunded[hook.Ref]
+		}
+	default:
+		return event, false, nil
+	}
+
+	return event, true, nil
+}
@@ -0,0 +1,161 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"eventy/config"
+	"eventy/pkg/models"
+	"net/http"
+	"testing"
+)
+
+const testFakeSecret = "fake-test-secret"
+
+// signedFakeWebhook returns the payload of a fake webhook and its signed header
+func signedFakeWebhook(t *testing.T, f *FakeProvider, hook FakeWebhook) ([]byte, http.Header) {
+	t.Helper()
+	payload, err := json.Marshal(hook)
+	if err != nil {
+		t.Fatalf("encoding webhook: %v", err)
+	}
+	header := http.Header{}
+	header.Set("Fake-Signature", f.Sign(payload))
+	return payload, header
+}
+
+func TestNewRefusesUnsafeFakeProvider(t *testing.T) {
+	saved := config.Configvar.Payment
+	t.Cleanup(func() { config.Configvar.Payment = saved })
+
+	config.Configvar.Payment.FakeEnabled = false
+	config.Configvar.Payment.FakeWebhookSecret = testFakeSecret
+	if _, err := New(ProviderFake); !errors.Is(err, ErrFakeDisabled) {
+		t.Errorf("fake provider not enabled: got %v, want ErrFakeDisabled", err)
+	}
+
+	config.Configvar.Payment.FakeEnabled = true
+	config.Configvar.Payment.FakeWebhookSecret = ""
+	if _, err := New(ProviderFake); !errors.Is(err, ErrFakeNoSecret) {
+		t.Errorf("fake provider without secret: got %v, want ErrFakeNoSecret", err)
+	}
+
+	config.Configvar.Payment.FakeWebhookSecret = testFakeSecret
+	provider, err := New(ProviderFake)
+	if err != nil {
+		t.Fatalf("enabled fake provider with a secret: %v", err)
+	}
+	if provider.Name() != ProviderFake {
+		t.Errorf("provider %q, want %q", provider.Name(), ProviderFake)
+	}
+}
+
+func TestCurrentWithoutProvider(t *testing.T) {
+	Set(nil)
+	if _, err := Current(); !errors.Is(err, ErrNoProvider) {
+		t.Errorf("no provider set: got %v, want ErrNoProvider", err)
+	}
+}
+
+func TestFakeWebhookRequiresSignature(t *testing.T) {
+	ctx := context.Background()
+	f := NewFakeProvider(testFakeSecret, 0)
+	intent, err := f.CreateIntent(ctx, IntentRequest{Amount: 1500, Currency: "usd"})
+	if err != nil {
+		t.Fatalf("creating intent: %v", err)
+	}
+
+	hook := FakeWebhook{ID: "evt_1", Type: FakeEventSucceeded, Ref: intent.ID}
+	payload, header := signedFakeWebhook(t, f, hook)
+
+	if _, _, err := f.ParseWebhook(payload, http.Header{}); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("unsigned webhook: got %v, want ErrInvalidSignature", err)
+	}
+
+	forged := http.Header{}
+	forged.Set("Fake-Signature", NewFakeProvider("another-secret", 0).Sign(payload))
+	if _, _, err := f.ParseWebhook(payload, forged); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("webhook signed with another secret: got %v, want ErrInvalidSignature", err)
+	}
+
+	// Without a secret nothing is accepted, not even a payload signed with the empty key
+	open := NewFakeProvider("", 0)
+	if _, _, err := open.ParseWebhook(payload, http.Header{"Fake-Signature": {open.Sign(payload)}}); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("provider without secret: got %v, want ErrInvalidSignature", err)
+	}
+
+	event, ok, err := f.ParseWebhook(payload, header)
+	if err != nil || !ok {
+		t.Fatalf("signed webhook: ok %v, err %v", ok, err)
+	}
+	want := models.PaymentEvent{
+		ID:          "evt_1",
+		Type:        FakeEventSucceeded,
+		Kind:        models.PaymentEventSucceeded,
+		ProviderRef: intent.ID,
+		Amount:      1500,
+		Currency:    "usd",
+	}
+	if event != want {
+		t.Errorf("event %+v, want %+v", event, want)
+	}
+}
+
+func TestFakeIDsAreDeterministic(t *testing.T) {
+	ctx := context.Background()
+	f := NewFakeProvider(testFakeSecret, 41)
+
+	intent, err := f.CreateIntent(ctx, IntentRequest{Amount: 100, Currency: "usd"})
+	if err != nil {
+		t.Fatalf("creating intent: %v", err)
+	}
+	refund, err := f.Refund(ctx, intent.ID, RefundRequest{Amount: 100})
+	if err != nil {
+		t.Fatalf("refunding: %v", err)
+	}
+	if intent.ID != "fake_pi_42" || intent.ClientSecret != "fake_pi_42_secret" || refund.ID != "fake_re_43" {
+		t.Errorf("intent %s with secret %s, refund %s, want fake_pi_42, fake_pi_42_secret and fake_re_43", intent.ID, intent.ClientSecret, refund.ID)
+	}
+
+	again, err := NewFakeProvider(testFakeSecret, 41).CreateIntent(ctx, IntentRequest{Amount: 100, Currency: "usd"})
+	if err != nil {
+		t.Fatalf("creating intent: %v", err)
+	}
+	if again.ID != intent.ID {
+		t.Errorf("same seed created %s, then %s", intent.ID, again.ID)
+	}
+}
+
+func TestFakeRefundIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	f := NewFakeProvider(testFakeSecret, 0)
+	intent, err := f.CreateIntent(ctx, IntentRequest{Amount: 1000, Currency: "usd"})
+	if err != nil {
+		t.Fatalf("creating intent: %v", err)
+	}
+
+	req := RefundRequest{Amount: 400, IdempotencyKey: "refund-1"}
+	first, err := f.Refund(ctx, intent.ID, req)
+	if err != nil {
+		t.Fatalf("refunding: %v", err)
+	}
+	again, err := f.Refund(ctx, intent.ID, req)
+	if err != nil {
+		t.Fatalf("refunding again: %v", err)
+	}
+	if again.ID != first.ID {
+		t.Errorf("same key refunded twice: %s then %s", first.ID, again.ID)
+	}
+
+	// A retry under a new key is a new refund
+	retry, err := f.Refund(ctx, intent.ID, RefundRequest{Amount: 400, IdempotencyKey: "refund-1-1"})
+	if err != nil {
+		t.Fatalf("refunding under a new key: %v", err)
+	}
+	if retry.ID == first.ID {
+		t.Errorf("new key replayed refund %s", first.ID)
+	}
+	if _, err := f.Refund(ctx, intent.ID, RefundRequest{Amount: 400, IdempotencyKey: "refund-2"}); err == nil {
+		t.Error("refunding more than the intent amount succeeded")
+	}
+}
@@ -0,0 +1,144 @@
+package payment
+
+import (
+	"errors"
+	"eventy/middleware"
+	"eventy/pkg/db"
+	"eventy/pkg/models"
+	"eventy/pkg/notify"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// PayEvent holds the seats with a pending booking and creates the payment intent paying for it.
+// The amount is priced on the server from the event, the booking is confirmed by the webhook
+// once the provider reports the payment succeeded.
+func PayEvent(c *gin.Context) {
+	// Get the event_id and user_id from the request body, any client price is ignored
+	var req struct {
+		EventID      string            `json:"event_id" binding:"required"`
+		UserID       string            `json:"user_id"`
+		TicketTypeID int               `json:"ticket_type_id"` // required for events with ticket types
+		PromoCode    string            `json:"promo_code"`
+		Seats        int               `json:"seats" binding:"omitempty,gte=1"` // defaults to one seat
+		Attendees    []models.Attendee `json:"attendees" binding:"omitempty,dive"`
+	}
+
+	// Bind request data
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	eventID, err := strconv.Atoi(req.EventID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event_id"})
+		return
+	}
+
+	// The paying user is always the authenticated one
+	userID, ok := middleware.ResolveUserID(c, req.UserID)
+	if !ok {
+		return
+	}
+	req.UserID = strconv.Itoa(userID)
+
+	ctx := c.Request.Context()
+	provider, err := Current()
+	if err != nil {
+		log.Err(err).Msg("Payment provider unavailable")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Payments are not available right now"})
+		return
+	}
+
+	// Hold the seats until the payment succeeds
+	booking, quote, err := db.CreatePendingBooking(ctx, eventID, userID, db.BookingOptions{
+		TicketTypeID: req.TicketTypeID,
+		PromoCode:    req.PromoCode,
+		Seats:        req.Seats,
+		Attendees:    req.Attendees,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrEventNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, db.ErrEventFull), errors.Is(err, db.ErrAlreadyBooked), errors.Is(err, db.ErrEventCancelled):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, db.ErrNothingToPay), errors.Is(err, db.ErrPromoNotFound), errors.Is(err, db.ErrPromoNotApplicable),
+			errors.Is(err, db.ErrTicketTypeNotFound), errors.Is(err, db.ErrTicketTypeRequired),
+			errors.Is(err, db.ErrSeatLimit), errors.Is(err, db.ErrTooManyAttendees):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, db.ErrPromoExhausted), errors.Is(err, db.ErrPromoUserLimit),
+			errors.Is(err, db.ErrTicketTypeNotOnSale), errors.Is(err, db.ErrTicketTypeSoldOut):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			log.Err(err).Int("EventID", eventID).Int("UserID", userID).Msg("Error holding seat")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to book the event"})
+		}
+		return
+	}
+
+	// Metadata ties the payment back to the booking in the provider dashboard
+	intent, err := provider.CreateIntent(ctx, IntentRequest{
+		Amount:   quote.Total,
+		Currency: quote.Currency,
+		Metadata: map[string]string{
+			"user_id":        req.UserID,
+			"event_id":       req.EventID,
+			"booking_id":     strconv.Itoa(booking.BookingID),
+			"purpose":        models.PaymentPurposeBooking,
+			"promo_code":     quote.Promo,
+			"ticket_type_id": strconv.Itoa(booking.TicketTypeID),
+			"seats":          strconv.Itoa(booking.Seats),
+		},
+	})
+	if err != nil {
+		log.Err(err).Int("BookingID", booking.BookingID).Msg("Error creating payment intent")
+		releaseBooking(c, booking.BookingID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment"})
+		return
+	}
+
+	err = db.AddPayment(ctx, &models.Payment{
+		Provider:    provider.Name(),
+		ProviderRef: intent.ID,
+		Purpose:     models.PaymentPurposeBooking,
+		UserID:      userID,
+		EventID:     eventID,
+		BookingID:   booking.BookingID,
+		Amount:      quote.Total,
+		Currency:    quote.Currency,
+	})
+	if err != nil {
+		log.Err(err).Str("Intent", intent.ID).Msg("Error recording payment")
+		if err := provider.CancelIntent(ctx, intent.ID); err != nil {
+			log.Err(err).Str("Intent", intent.ID).Msg("Error cancelling payment intent")
+		}
+		releaseBooking(c, booking.BookingID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record payment"})
+		return
+	}
+
+	// Return the client secret so the frontend can complete the payment
+	c.JSON(http.StatusOK, gin.H{
+		"client_secret": intent.ClientSecret,
+		"provider":      provider.Name(),
+		"event_id":      req.EventID,
+		"user_id":       req.UserID, // Optionally return the user_id in the response
+		"booking_id":    booking.BookingID,
+		"quote":         quote,
+	})
+}
+
+// releaseBooking gives back the seat of a booking whose payment could not be created
+func releaseBooking(c *gin.Context, bookingID int) {
+	promotions, err := db.ReleasePendingBooking(c.Request.Context(), bookingID)
+	if err != nil {
+		log.Err(err).Int("BookingID", bookingID).Msg("Error releasing pending booking")
+		return
+	}
+	notify.WaitlistPromotions(c.Request.Context(), promotions)
+}
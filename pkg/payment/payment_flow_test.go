@@ -0,0 +1,310 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"eventy/config"
+	"eventy/middleware"
+	"eventy/pkg/db"
+	"eventy/pkg/db/dbtest"
+	"eventy/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupFlow opens the test database and installs a fake provider, the previous configuration comes back on cleanup
+func setupFlow(t *testing.T) *FakeProvider {
+	t.Helper()
+	dbtest.Open(t)
+
+	saved := config.Configvar.Payment
+	config.Configvar.Payment.Currency = "usd"
+	config.Configvar.Payment.TopupMin = 100
+	config.Configvar.Payment.TopupMax = 100000
+
+	// Provider refs are stored once, the seed keeps them apart from earlier runs on the same database
+	fake := NewFakeProvider(testFakeSecret, dbtest.Seed())
+	Set(fake)
+	t.Cleanup(func() {
+		config.Configvar.Payment = saved
+		Set(nil)
+	})
+	return fake
+}
+
+// newTestRouter serves the payment routes with userID authenticated, as TokenMiddleware3rdParty would
+func newTestRouter(userID int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	auth := func(c *gin.Context) {
+		c.Set(middleware.CtxClaims, &middleware.ClaimsBackOffice{Role: middleware.RoleMobileUser, UserID: userID})
+		c.Set(middleware.CtxUserID, userID)
+	}
+	router.POST("/mobile/pay", auth, PayEvent)
+	router.POST("/mobile/topup", auth, TopupWallet)
+	router.POST("/payment/webhook", Webhook)
+	return router
+}
+
+func post(t *testing.T, router *gin.Engine, path string, body []byte, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func postJSON(t *testing.T, router *gin.Engine, path string, body any) map[string]any {
+	t.Helper()
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("encoding request: %v", err)
+	}
+	rec := post(t, router, path, payload, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST %s: status %d, body %s", path, rec.Code, rec.Body)
+	}
+	var response map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decoding response of %s: %v", path, err)
+	}
+	return response
+}
+
+// sendFakeWebhook posts a signed fake provider event and returns the response status
+func sendFakeWebhook(t *testing.T, router *gin.Engine, fake *FakeProvider, hook FakeWebhook) *httptest.ResponseRecorder {
+	t.Helper()
+	payload, header := signedFakeWebhook(t, fake, hook)
+	return post(t, router, "/payment/webhook", payload, header)
+}
+
+func onlyPayment(t *testing.T, bookingID, userID int) models.Payment {
+	t.Helper()
+	payments, err := db.GetPayments(context.Background(), bookingID, userID)
+	if err != nil {
+		t.Fatalf("getting payments: %v", err)
+	}
+	if len(payments) != 1 {
+		t.Fatalf("%d payments, want 1", len(payments))
+	}
+	return payments[0]
+}
+
+func TestCardBookingFlow(t *testing.T) {
+	fake := setupFlow(t)
+	ctx := context.Background()
+
+	user := dbtest.NewUser(t, 0)
+	event := dbtest.NewEvent(t, 10, 2500)
+	router := newTestRouter(user.UserID)
+
+	// The seat is held by a pending booking until the provider reports the payment
+	response := postJSON(t, router, "/mobile/pay", map[string]any{"event_id": strconv.Itoa(event.EventID)})
+	bookingID := int(response["booking_id"].(float64))
+	payment := onlyPayment(t, bookingID, 0)
+	if payment.Amount != 2500 || payment.Provider != ProviderFake {
+		t.Fatalf("payment %+v, want 2500 with the fake provider", payment)
+	}
+
+	booking, err := db.GetBookingByID(ctx, bookingID)
+	if err != nil {
+		t.Fatalf("getting booking: %v", err)
+	}
+	if booking.Status != models.BookingStatusPending {
+		t.Fatalf("booking %s before the webhook, want pending", booking.Status)
+	}
+
+	// An unsigned webhook is refused and changes nothing
+	unsigned, _ := json.Marshal(FakeWebhook{ID: "evt_forged_" + payment.ProviderRef, Type: FakeEventSucceeded, Ref: payment.ProviderRef})
+	if rec := post(t, router, "/payment/webhook", unsigned, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("unsigned webhook: status %d, want 400", rec.Code)
+	}
+
+	eventID := "evt_paid_" + payment.ProviderRef
+	if rec := sendFakeWebhook(t, router, fake, FakeWebhook{ID: eventID, Type: FakeEventSucceeded, Ref: payment.ProviderRef}); rec.Code != http.StatusOK {
+		t.Fatalf("succeeded webhook: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	booking, err = db.GetBookingByID(ctx, bookingID)
+	if err != nil {
+		t.Fatalf("getting booking: %v", err)
+	}
+	if booking.Status != models.BookingStatusConfirmed || booking.PaymentRef != payment.ProviderRef {
+		t.Fatalf("booking %s paid by %q, want confirmed by %s", booking.Status, booking.PaymentRef, payment.ProviderRef)
+	}
+	tickets, err := db.GetTicketsByBooking(ctx, bookingID)
+	if err != nil {
+		t.Fatalf("getting tickets: %v", err)
+	}
+	if len(tickets) != 1 || tickets[0].Status != models.TicketStatusValid {
+		t.Fatalf("tickets %+v, want one valid ticket", tickets)
+	}
+
+	// A redelivered event is acknowledged without issuing anything again
+	rec := sendFakeWebhook(t, router, fake, FakeWebhook{ID: eventID, Type: FakeEventSucceeded, Ref: payment.ProviderRef})
+	if rec.Code != http.StatusOK || !bytes.Contains(rec.Body.Bytes(), []byte(`"duplicate":true`)) {
+		t.Errorf("replayed webhook: status %d, body %s, want a duplicate", rec.Code, rec.Body)
+	}
+	if tickets, err = db.GetTicketsByBooking(ctx, bookingID); err != nil || len(tickets) != 1 {
+		t.Fatalf("%d tickets after a replay (err %v), want 1", len(tickets), err)
+	}
+
+	// Cancelling refunds the card through the provider
+	result, err := db.CancelBooking(ctx, db.CancelBookingParams{BookingID: bookingID, Actor: "system", FullRefund: true})
+	if err != nil {
+		t.Fatalf("cancelling booking: %v", err)
+	}
+	if result.Refund.Method != models.RefundMethodCard || result.Refund.Status != models.RefundStatusPending || result.Refund.Amount != 2500 {
+		t.Fatalf("refund %+v, want a pending card refund of 2500", result.Refund)
+	}
+	ProcessRefunds(ctx, result.Refund)
+
+	refund, err := db.GetRefundByID(ctx, result.Refund.RefundID)
+	if err != nil {
+		t.Fatalf("getting refund: %v", err)
+	}
+	if refund.Status != models.RefundStatusSucceeded || refund.ProviderRef == "" {
+		t.Fatalf("refund %s with provider ref %q, want succeeded", refund.Status, refund.ProviderRef)
+	}
+
+	// The provider then reports the refund, it is not counted twice
+	refundedID := "evt_refunded_" + payment.ProviderRef
+	if rec := sendFakeWebhook(t, router, fake, FakeWebhook{ID: refundedID, Type: FakeEventRefunded, Ref: payment.ProviderRef}); rec.Code != http.StatusOK {
+		t.Fatalf("refunded webhook: status %d, body %s", rec.Code, rec.Body)
+	}
+	payment = onlyPayment(t, bookingID, 0)
+	if payment.Status != models.PaymentStatusRefunded || payment.AmountRefunded != 2500 {
+		t.Errorf("payment %s with %d refunded, want refunded with 2500", payment.Status, payment.AmountRefunded)
+	}
+
+	tickets, err = db.GetTicketsByBooking(ctx, bookingID)
+	if err != nil {
+		t.Fatalf("getting tickets: %v", err)
+	}
+	if len(tickets) != 1 || tickets[0].Status != models.TicketStatusVoid {
+		t.Errorf("tickets %+v, want the ticket voided", tickets)
+	}
+}
+
+func TestTopupFlow(t *testing.T) {
+	fake := setupFlow(t)
+
+	user := dbtest.NewUser(t, 0)
+	router := newTestRouter(user.UserID)
+
+	response := postJSON(t, router, "/mobile/topup", map[string]any{"amount": 1000})
+	paymentID := int(response["payment_id"].(float64))
+	payment, err := db.GetPaymentByID(context.Background(), paymentID)
+	if err != nil {
+		t.Fatalf("getting payment: %v", err)
+	}
+
+	if stored, _ := dbtest.Balances(t, user.UserID); stored != 0 {
+		t.Fatalf("balance %d before the webhook, want 0", stored)
+	}
+	hook := FakeWebhook{ID: "evt_topup_" + payment.ProviderRef, Type: FakeEventSucceeded, Ref: payment.ProviderRef}
+	if rec := sendFakeWebhook(t, router, fake, hook); rec.Code != http.StatusOK {
+		t.Fatalf("succeeded webhook: status %d, body %s", rec.Code, rec.Body)
+	}
+	stored, ledger := dbtest.Balances(t, user.UserID)
+	if stored != 1000 || ledger != 1000 {
+		t.Fatalf("balance %d, ledger %d after the top-up, want 1000", stored, ledger)
+	}
+
+	// A provider amount that differs from the top-up is flagged, not credited
+	response = postJSON(t, router, "/mobile/topup", map[string]any{"amount": 500})
+	payment, err = db.GetPaymentByID(context.Background(), int(response["payment_id"].(float64)))
+	if err != nil {
+		t.Fatalf("getting payment: %v", err)
+	}
+	hook = FakeWebhook{ID: "evt_topup_" + payment.ProviderRef, Type: FakeEventSucceeded, Ref: payment.ProviderRef, Amount: 50000}
+	if rec := sendFakeWebhook(t, router, fake, hook); rec.Code != http.StatusOK {
+		t.Fatalf("succeeded webhook: status %d, body %s", rec.Code, rec.Body)
+	}
+	if stored, _ := dbtest.Balances(t, user.UserID); stored != 1000 {
+		t.Errorf("balance %d after a mismatched top-up, want 1000", stored)
+	}
+	payment, err = db.GetPaymentByID(context.Background(), payment.PaymentID)
+	if err != nil {
+		t.Fatalf("getting payment: %v", err)
+	}
+	if payment.FailureReason == "" {
+		t.Errorf("mismatched top-up %d was not flagged", payment.PaymentID)
+	}
+}
+
+// paidCardBooking books the event for the user by card and confirms it through a signed webhook
+func paidCardBooking(t *testing.T, router *gin.Engine, fake *FakeProvider, eventID int) (int, models.Payment) {
+	t.Helper()
+	response := postJSON(t, router, "/mobile/pay", map[string]any{"event_id": strconv.Itoa(eventID)})
+	bookingID := int(response["booking_id"].(float64))
+	payment := onlyPayment(t, bookingID, 0)
+
+	hook := FakeWebhook{ID: "evt_paid_" + payment.ProviderRef, Type: FakeEventSucceeded, Ref: payment.ProviderRef}
+	if rec := sendFakeWebhook(t, router, fake, hook); rec.Code != http.StatusOK {
+		t.Fatalf("succeeded webhook: status %d, body %s", rec.Code, rec.Body)
+	}
+	return bookingID, payment
+}
+
+func TestFullCardRefundCancelsBookingWhicheverArrivesFirst(t *testing.T) {
+	fake := setupFlow(t)
+	ctx := context.Background()
+
+	user := dbtest.NewUser(t, 0)
+	event := dbtest.NewEvent(t, 10, 1800)
+	router := newTestRouter(user.UserID)
+	bookingID, payment := paidCardBooking(t, router, fake, event.EventID)
+
+	// A refund of the whole price keeps the booking until the provider has refunded it
+	refund, err := db.RefundBooking(ctx, db.RefundBookingParams{BookingID: bookingID, Amount: 1800, Reason: "goodwill", Actor: "operator:test"})
+	if err != nil {
+		t.Fatalf("refunding booking: %v", err)
+	}
+
+	// The provider answer is recorded before its webhook
+	ProcessRefunds(ctx, refund)
+	payment = onlyPayment(t, bookingID, 0)
+	if payment.Status != models.PaymentStatusRefunded || payment.AmountRefunded != 1800 {
+		t.Fatalf("payment %s with %d refunded, want refunded with 1800", payment.Status, payment.AmountRefunded)
+	}
+
+	hook := FakeWebhook{ID: "evt_refunded_" + payment.ProviderRef, Type: FakeEventRefunded, Ref: payment.ProviderRef}
+	if rec := sendFakeWebhook(t, router, fake, hook); rec.Code != http.StatusOK {
+		t.Fatalf("refunded webhook: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	booking, err := db.GetBookingByID(ctx, bookingID)
+	if err != nil {
+		t.Fatalf("getting booking: %v", err)
+	}
+	if booking.Status != models.BookingStatusCancelled {
+		t.Errorf("booking %s after a full refund, want cancelled", booking.Status)
+	}
+	tickets, err := db.GetTicketsByBooking(ctx, bookingID)
+	if err != nil {
+		t.Fatalf("getting tickets: %v", err)
+	}
+	for _, ticket := range tickets {
+		if ticket.Status != models.TicketStatusVoid {
+			t.Errorf("ticket %d is %s after a full refund, want void", ticket.TicketID, ticket.Status)
+		}
+	}
+	refunds, err := db.GetRefunds(ctx, bookingID, 0)
+	if err != nil {
+		t.Fatalf("getting refunds: %v", err)
+	}
+	if len(refunds) != 1 {
+		t.Errorf("%d refunds recorded, want only the one sent", len(refunds))
+	}
+}
@@ -0,0 +1,117 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"eventy/config"
+	"eventy/pkg/models"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrNoProvider       = errors.New("no payment provider configured")
+	ErrFakeDisabled     = errors.New("the fake payment provider is disabled, set PAYMENT_FAKE_ENABLED=true to use it")
+	ErrFakeNoSecret     = errors.New("the fake payment provider needs FAKE_WEBHOOK_SECRET")
+)
+
+// IntentRequest describes a payment to collect
+type IntentRequest struct {
+	Amount   int // smallest currency unit
+	Currency string
+	Metadata map[string]string
+}
+
+// Intent is a payment created with the provider, the client completes it with ClientSecret
+type Intent struct {
+	ID           string
+	ClientSecret string
+	Amount       int
+	Currency     string
+	Status       string
+}
+
+// RefundRequest describes money to give back on a succeeded intent
+type RefundRequest struct {
+	Amount         int // smallest currency unit, 0 refunds what is left
+	Reason         string
+	IdempotencyKey string // the same key never refunds twice
+}
+
+// RefundResult is the provider outcome of a refund
+type RefundResult struct {
+	ID     string
+	Amount int
+	Status string // provider status, e.g. succeeded or pending
+}
+
+// Provider is a card payment backend
+type Provider interface {
+	// Name is stored on payments so webhooks are matched to the provider that created them
+	Name() string
+	CreateIntent(ctx context.Context, req IntentRequest) (*Intent, error)
+	CancelIntent(ctx context.Context, id string) error
+	// Capture collects an authorized intent, amount 0 captures the full amount
+	Capture(ctx context.Context, id string, amount int) (*Intent, error)
+	// Refund gives back part or all of a succeeded intent
+	Refund(ctx context.Context, id string, req RefundRequest) (*RefundResult, error)
+	// ParseWebhook verifies a notification and maps it to a payment event,
+	// ok is false for events that do not concern payments
+	ParseWebhook(payload []byte, header http.Header) (event models.PaymentEvent, ok bool, err error)
+}
+
+var (
+	mu      sync.RWMutex
+	current Provider
+)
+
+// Init selects the provider configured through PAYMENT_PROVIDER
+func Init() error {
+	provider, err := New(config.Configvar.Payment.Provider)
+	if err != nil {
+		return err
+	}
+	Set(provider)
+	log.Info().Str("Provider", provider.Name()).Msg("Payment provider ready")
+	return nil
+}
+
+// New builds a provider by name
+func New(name string) (Provider, error) {
+	switch name {
+	case "", ProviderStripe:
+		return NewStripeProvider(config.Configvar.Payment.StripeSecretKey, config.Configvar.Payment.StripeWebhookSecret), nil
+	case ProviderFake:
+		// Anyone able to sign its webhooks confirms payments, it must be enabled on purpose
+		if !config.Configvar.Payment.FakeEnabled {
+			return nil, ErrFakeDisabled
+		}
+		if config.Configvar.Payment.FakeWebhookSecret == "" {
+			return nil, ErrFakeNoSecret
+		}
+		return NewFakeProvider(config.Configvar.Payment.FakeWebhookSecret, config.Configvar.Payment.FakeIDSeed), nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", name)
+	}
+}
+
+// Set replaces the provider in use
+func Set(p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = p
+}
+
+// Current returns the provider in use, ErrNoProvider until Init or Set selected one
+func Current() (Provider, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if current == nil {
+		return nil, ErrNoProvider
+	}
+	return current, nil
+}
@@ -0,0 +1,85 @@
+package payment
+
+import (
+	"context"
+	"eventy/pkg/db"
+	"eventy/pkg/models"
+	"eventy/pkg/notify"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ProcessRefunds sends pending card refunds to the payment provider. Wallet refunds and refunds
+// already sent are skipped, failures are recorded on the refund to be retried from the back-office.
+func ProcessRefunds(ctx context.Context, refunds ...*models.Refund) {
+	for _, refund := range refunds {
+		if refund == nil || refund.Method != models.RefundMethodCard ||
+			refund.Status != models.RefundStatusPending || refund.ProviderRef != "" {
+			continue
+		}
+		if err := sendRefund(ctx, refund); err != nil {
+			log.Err(err).Int("RefundID", refund.RefundID).Msg("Error sending refund to the payment provider")
+		}
+	}
+}
+
+// ProcessPendingRefunds sends every card refund still waiting for the provider
+func ProcessPendingRefunds(ctx context.Context) error {
+	refunds, err := db.GetUnsentCardRefunds(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range refunds {
+		ProcessRefunds(ctx, &refunds[i])
+	}
+	return nil
+}
+
+// refundKey is the idempotency key of a refund attempt. A lost answer is resent with the same
+// key and never refunds twice, a retry after a failure gets a new key since the provider
+// replays the stored failure for a known key.
+func refundKey(refund *models.Refund) string {
+	if refund.Attempts == 0 {
+		return fmt.Sprintf("refund-%d", refund.RefundID)
+	}
+	return fmt.Sprintf("refund-%d-%d", refund.RefundID, refund.Attempts)
+}
+
+// sendRefund refunds the original payment under the idempotency key of the attempt
+func sendRefund(ctx context.Context, refund *models.Refund) error {
+	payment, err := db.GetPaymentByID(ctx, refund.PaymentID)
+	if err != nil {
+		return err
+	}
+
+	provider, err := Current()
+	if err != nil {
+		return err
+	}
+	if payment.Provider != provider.Name() {
+		return db.FailCardRefund(ctx, refund.RefundID,
+			fmt.Sprintf("payment was made with %s, current provider is %s", payment.Provider, provider.Name()))
+	}
+
+	result, err := provider.Refund(ctx, payment.ProviderRef, RefundRequest{
+		Amount:         refund.Amount,
+		Reason:         refund.Reason,
+		IdempotencyKey: refundKey(refund),
+	})
+	if err != nil {
+		refund.Status = models.RefundStatusFailed
+		refund.FailureReason = err.Error()
+		return db.FailCardRefund(ctx, refund.RefundID, err.Error())
+	}
+
+	updated, promotions, err := db.CompleteCardRefund(ctx, refund.RefundID, result.ID, result.Status)
+	if err != nil {
+		return err
+	}
+	*refund = *updated
+	notify.WaitlistPromotions(ctx, promotions)
+
+	log.Info().Msgf("Refund %d of %d sent to %s as %s (%s)", refund.RefundID, refund.Amount, provider.Name(), result.ID, result.Status)
+	return nil
+}
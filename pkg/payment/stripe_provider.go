@@ -0,0 +1,157 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"eventy/pkg/models"
+	"fmt"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+	"github.com/stripe/stripe-go/v75"
+	"github.com/stripe/stripe-go/v75/paymentintent"
+	"github.com/stripe/stripe-go/v75/refund"
+	"github.com/stripe/stripe-go/v75/webhook"
+)
+
+const ProviderStripe = "stripe"
+
+// StripeProvider collects payments with Stripe PaymentIntents
+type StripeProvider struct {
+	intents       paymentintent.Client
+	refunds       refund.Client
+	webhookSecret string
+}
+
+// NewStripeProvider builds a provider using its own key instead of the stripe-go global one
+func NewStripeProvider(key, webhookSecret string) *StripeProvider {
+	if key == "" {
+		log.Warn().Msg("STRIPE_SECRET_KEY is not set, card payments will fail")
+	}
+	if webhookSecret == "" {
+		log.Warn().Msg("STRIPE_WEBHOOK_SECRET is not set, Stripe webhooks will be rejected")
+	}
+
+	backend := stripe.GetBackend(stripe.APIBackend)
+	return &StripeProvider{
+		intents:       paymentintent.Client{B: backend, Key: key},
+		refunds:       refund.Client{B: backend, Key: key},
+		webhookSecret: webhookSecret,
+	}
+}
+
+func (s *StripeProvider) Name() string { return ProviderStripe }
+
+func (s *StripeProvider) CreateIntent(ctx context.Context, req IntentRequest) (*Intent, error) {
+	params := &stripe.PaymentIntentParams{
+		Amount:   stripe.Int64(int64(req.Amount)),
+		Currency: stripe.String(req.Currency),
+	}
+	params.Context = ctx
+	for key, value := range req.Metadata {
+		params.AddMetadata(key, value)
+	}
+
+	pi, err := s.intents.New(params)
+	if err != nil {
+		return nil, err
+	}
+	return stripeIntent(pi), nil
+}
+
+func (s *StripeProvider) CancelIntent(ctx context.Context, id string) error {
+	params := &stripe.PaymentIntentCancelParams{}
+	params.Context = ctx
+	_, err := s.intents.Cancel(id, params)
+	return err
+}
+
+func (s *StripeProvider) Capture(ctx context.Context, id string, amount int) (*Intent, error) {
+	params := &stripe.PaymentIntentCaptureParams{}
+	params.Context = ctx
+	if amount > 0 {
+		params.AmountToCapture = stripe.Int64(int64(amount))
+	}
+
+	pi, err := s.intents.Capture(id, params)
+	if err != nil {
+		return nil, err
+	}
+	return stripeIntent(pi), nil
+}
+
+func (s *StripeProvider) Refund(ctx context.Context, id string, req RefundRequest) (*RefundResult, error) {
+	params := &stripe.RefundParams{PaymentIntent: stripe.String(id)}
+	params.Context = ctx
+	if req.Amount > 0 {
+		params.Amount = stripe.Int64(int64(req.Amount))
+	}
+	if req.Reason != "" {
+		params.AddMetadata("reason", req.Reason)
+	}
+	if req.IdempotencyKey != "" {
+		params.SetIdempotencyKey(req.IdempotencyKey)
+	}
+
+	r, err := s.refunds.New(params)
+	if err != nil {
+		return nil, err
+	}
+	return &RefundResult{ID: r.ID, Amount: int(r.Amount), Status: string(r.Status)}, nil
+}
+
+// ParseWebhook verifies the Stripe-Signature header and maps the events we act on
+func (s *StripeProvider) ParseWebhook(payload []byte, header http.Header) (models.PaymentEvent, bool, error) {
+	event, err := webhook.ConstructEventWithOptions(payload, header.Get("Stripe-Signature"), s.webhookSecret,
+		webhook.ConstructEventOptions{IgnoreAPIVersionMismatch: true})
+	if err != nil {
+		return models.PaymentEvent{}, false, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	paymentEvent := models.PaymentEvent{ID: event.ID, Type: string(event.Type)}
+
+	switch event.Type {
+	case stripe.EventTypePaymentIntentSucceeded, stripe.EventTypePaymentIntentPaymentFailed:
+		var pi stripe.PaymentIntent
+		if err := json.Unmarshal(event.Data.Raw, &pi); err != nil {
+			return paymentEvent, false, err
+		}
+		paymentEvent.ProviderRef = pi.ID
+		paymentEvent.Kind = models.PaymentEventSucceeded
+		paymentEvent.Amount = int(pi.AmountReceived)
+		paymentEvent.Currency = string(pi.Currency)
+		if event.Type == stripe.EventTypePaymentIntentPaymentFailed {
+			paymentEvent.Kind = models.PaymentEventFailed
+			if pi.LastPaymentError != nil {
+				paymentEvent.FailureReason = pi.LastPaymentError.Msg
+			}
+		}
+
+	case stripe.EventTypeChargeRefunded:
+		var charge stripe.Charge
+		if err := json.Unmarshal(event.Data.Raw, &charge); err != nil {
+			return paymentEvent, false, err
+		}
+		if charge.PaymentIntent == nil {
+			return paymentEvent, false, nil
+		}
+		paymentEvent.ProviderRef = charge.PaymentIntent.ID
+		paymentEvent.Kind = models.PaymentEventRefunded
+		paymentEvent.AmountRefunded = int(charge.AmountRefunded)
+
+	default:
+		return paymentEvent, false, nil
+	}
+
+	return paymentEvent, true, nil
+}
+
+func stripeIntent(pi *stripe.PaymentIntent) *Intent {
+	return &Intent{
+		ID:           pi.ID,
+		ClientSecret: pi.ClientSecret,
+		Amount:       int(pi.Amount),
+		Currency:     string(pi.Currency),
+		Status:       string(pi.Status),
+	}
+}
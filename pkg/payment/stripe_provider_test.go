@@ -0,0 +1,198 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"eventy/pkg/db"
+	"eventy/pkg/db/dbtest"
+	"eventy/pkg/models"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v75/webhook"
+)
+
+const (
+	testStripeSecret = "whsec_test_eventy"
+
+	// IDs used in the fixtures of testdata
+	fixtureSucceededEvent = "evt_3OpXmQJ2eZvKYlo21nB5cT9d"
+	fixturePaidIntent     = "pi_3OpXmQJ2eZvKYlo21gq8Zx4F"
+	fixtureFailedIntent   = "pi_3OpXnRJ2eZvKYlo20hT6Yv3B"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	payload, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("reading fixture: %v", err)
+	}
+	return payload
+}
+
+// signStripe returns the Stripe-Signature header of payload as Stripe would send it at timestamp
+func signStripe(payload []byte, secret string, timestamp time.Time) http.Header {
+	signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+		Payload:   payload,
+		Secret:    secret,
+		Timestamp: timestamp,
+	})
+	header := http.Header{}
+	header.Set("Stripe-Signature", signed.Header)
+	return header
+}
+
+func TestStripeWebhookFixtures(t *testing.T) {
+	s := NewStripeProvider("", testStripeSecret)
+
+	tests := []struct {
+		fixture string
+		want    models.PaymentEvent
+	}{
+		{
+			fixture: "stripe_payment_intent_succeeded.json",
+			want: models.PaymentEvent{
+				ID:          fixtureSucceededEvent,
+				Type:        "payment_intent.succeeded",
+				Kind:        models.PaymentEventSucceeded,
+				ProviderRef: fixturePaidIntent,
+				Amount:      2500,
+				Currency:    "usd",
+			},
+		},
+		{
+			fixture: "stripe_payment_intent_payment_failed.json",
+			want: models.PaymentEvent{
+				ID:            "evt_3OpXnRJ2eZvKYlo20Kd8sW1q",
+				Type:          "payment_intent.payment_failed",
+				Kind:          models.PaymentEventFailed,
+				ProviderRef:   fixtureFailedIntent,
+				Currency:      "usd",
+				FailureReason: "Your card has insufficient funds.",
+			},
+		},
+		{
+			fixture: "stripe_charge_refunded.json",
+			want: models.PaymentEvent{
+				ID:             "evt_3OpXmQJ2eZvKYlo21Rf4uE7a",
+				Type:           "charge.refunded",
+				Kind:           models.PaymentEventRefunded,
+				ProviderRef:    fixturePaidIntent,
+				AmountRefunded: 1000,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			payload := readFixture(t, tt.fixture)
+			event, ok, err := s.ParseWebhook(payload, signStripe(payload, testStripeSecret, time.Now()))
+			if err != nil || !ok {
+				t.Fatalf("ok %v, err %v", ok, err)
+			}
+			if event != tt.want {
+				t.Errorf("event %+v, want %+v", event, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripeWebhookRejectsBadSignatures(t *testing.T) {
+	s := NewStripeProvider("", testStripeSecret)
+	payload := readFixture(t, "stripe_payment_intent_succeeded.json")
+
+	tampered := []byte(strings.Replace(string(payload), `"amount_received": 2500`, `"amount_received": 250000`, 1))
+
+	tests := []struct {
+		name    string
+		payload []byte
+		header  http.Header
+	}{
+		{"unsigned", payload, http.Header{}},
+		{"other secret", payload, signStripe(payload, "whsec_someone_else", time.Now())},
+		{"tampered payload", tampered, signStripe(payload, testStripeSecret, time.Now())},
+		{"stale signature", payload, signStripe(payload, testStripeSecret, time.Now().Add(-time.Hour))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := s.ParseWebhook(tt.payload, tt.header); !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("got %v, want ErrInvalidSignature", err)
+			}
+		})
+	}
+}
+
+// stripeFixture reads a fixture with its event and intent IDs replaced, so each run stores events of its own
+func stripeFixture(t *testing.T, name string, ids map[string]string) []byte {
+	t.Helper()
+	payload := string(readFixture(t, name))
+	for from, to := range ids {
+		payload = strings.ReplaceAll(payload, from, to)
+	}
+	return []byte(payload)
+}
+
+func TestStripeWebhookReplay(t *testing.T) {
+	dbtest.Open(t)
+	s := NewStripeProvider("", testStripeSecret)
+	Set(s)
+	t.Cleanup(func() { Set(nil) })
+
+	ctx := context.Background()
+	user := dbtest.NewUser(t, 0)
+	router := newTestRouter(user.UserID)
+
+	suffix := fmt.Sprintf("%d", time.Now().UnixNano())
+	intentID := "pi_test_" + suffix
+	payment := &models.Payment{
+		Provider:    ProviderStripe,
+		ProviderRef: intentID,
+		Purpose:     models.PaymentPurposeTopup,
+		UserID:      user.UserID,
+		Amount:      2500,
+		Currency:    "usd",
+	}
+	if err := db.AddPayment(ctx, payment); err != nil {
+		t.Fatalf("adding payment: %v", err)
+	}
+
+	payload := stripeFixture(t, "stripe_payment_intent_succeeded.json", map[string]string{
+		fixtureSucceededEvent: "evt_test_" + suffix,
+		fixturePaidIntent:     intentID,
+	})
+
+	// A forged delivery is refused before anything is recorded
+	forged := post(t, router, "/payment/webhook", payload, signStripe(payload, "whsec_someone_else", time.Now()))
+	if forged.Code != http.StatusBadRequest {
+		t.Errorf("forged webhook: status %d, want 400", forged.Code)
+	}
+
+	for delivery := 1; delivery <= 3; delivery++ {
+		rec := post(t, router, "/payment/webhook", payload, signStripe(payload, testStripeSecret, time.Now()))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("delivery %d: status %d, body %s", delivery, rec.Code, rec.Body)
+		}
+		duplicate := strings.Contains(rec.Body.String(), `"duplicate":true`)
+		if duplicate != (delivery > 1) {
+			t.Errorf("delivery %d: duplicate %v", delivery, duplicate)
+		}
+
+		stored, ledger := dbtest.Balances(t, user.UserID)
+		if stored != 2500 || ledger != 2500 {
+			t.Fatalf("delivery %d: balance %d, ledger %d, want 2500 credited once", delivery, stored, ledger)
+		}
+	}
+
+	payment, err := db.GetPaymentByID(ctx, payment.PaymentID)
+	if err != nil {
+		t.Fatalf("getting payment: %v", err)
+	}
+	if payment.Status != models.PaymentStatusSucceeded {
+		t.Errorf("payment %s, want succeeded", payment.Status)
+	}
+}
@@ -0,0 +1,85 @@
+package payment
+
+import (
+	"eventy/config"
+	"eventy/middleware"
+	"eventy/pkg/db"
+	"eventy/pkg/models"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// TopupWallet creates the payment intent of a wallet top-up for the authenticated user.
+// Nothing is credited here, the webhook credits the wallet once the provider reports the payment succeeded.
+func TopupWallet(c *gin.Context) {
+	var req models.TopupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	limits := config.Configvar.Payment
+	if req.Amount < limits.TopupMin || (limits.TopupMax > 0 && req.Amount > limits.TopupMax) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Top-up amount must be between %d and %d", limits.TopupMin, limits.TopupMax),
+		})
+		return
+	}
+
+	userID, ok := middleware.ResolveUserID(c, "")
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	provider, err := Current()
+	if err != nil {
+		log.Err(err).Msg("Payment provider unavailable")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Payments are not available right now"})
+		return
+	}
+	currency := config.Configvar.Payment.Currency
+
+	intent, err := provider.CreateIntent(ctx, IntentRequest{
+		Amount:   req.Amount,
+		Currency: currency,
+		Metadata: map[string]string{
+			"user_id": strconv.Itoa(userID),
+			"purpose": models.PaymentPurposeTopup,
+		},
+	})
+	if err != nil {
+		log.Err(err).Int("UserID", userID).Msg("Error creating top-up payment intent")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment"})
+		return
+	}
+
+	payment := &models.Payment{
+		Provider:    provider.Name(),
+		ProviderRef: intent.ID,
+		Purpose:     models.PaymentPurposeTopup,
+		UserID:      userID,
+		Amount:      req.Amount,
+		Currency:    currency,
+	}
+	if err := db.AddPayment(ctx, payment); err != nil {
+		log.Err(err).Str("Intent", intent.ID).Msg("Error recording payment")
+		if err := provider.CancelIntent(ctx, intent.ID); err != nil {
+			log.Err(err).Str("Intent", intent.ID).Msg("Error cancelling payment intent")
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record payment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"client_secret": intent.ClientSecret,
+		"provider":      provider.Name(),
+		"payment_id":    payment.PaymentID,
+		"amount":        payment.Amount,
+		"currency":      payment.Currency,
+	})
+}
@@ -0,0 +1,70 @@
+package payment
+
+import (
+	"errors"
+	"eventy/pkg/db"
+	"eventy/pkg/notify"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// maxWebhookBody bounds the payload read from the provider
+const maxWebhookBody = 64 << 10
+
+// Webhook receives provider events, verifies their signature and applies them to the payment
+// they refer to. Each event ID is applied once, provider retries are acknowledged without effect.
+func Webhook(c *gin.Context) {
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		return
+	}
+
+	provider, err := Current()
+	if err != nil {
+		// A 5xx makes the provider retry the event once payments are configured
+		log.Err(err).Msg("Payment provider unavailable")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Payments are not available right now"})
+		return
+	}
+	event, ok, err := provider.ParseWebhook(payload, c.Request.Header)
+	if err != nil {
+		if errors.Is(err, ErrInvalidSignature) {
+			log.Warn().Err(err).Str("Provider", provider.Name()).Msg("Invalid webhook signature")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid signature"})
+			return
+		}
+		log.Warn().Err(err).Str("Provider", provider.Name()).Msg("Invalid webhook event")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event object"})
+		return
+	}
+	if !ok {
+		// Not an event we act on
+		c.JSON(http.StatusOK, gin.H{"received": true})
+		return
+	}
+
+	result, duplicate, err := db.HandlePaymentEvent(c.Request.Context(), provider.Name(), event)
+	if err != nil {
+		// A 5xx makes the provider retry the event later
+		log.Err(err).Str("Event", event.ID).Str("Type", event.Type).Msg("Error processing webhook event")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process event"})
+		return
+	}
+	if duplicate {
+		log.Debug().Str("Event", event.ID).Msg("Webhook event already processed")
+		c.JSON(http.StatusOK, gin.H{"received": true, "duplicate": true})
+		return
+	}
+
+	if result != nil {
+		ProcessRefunds(c.Request.Context(), result.Refund)
+		notify.WaitlistPromotions(c.Request.Context(), result.Promotions)
+	}
+
+	log.Info().Str("Event", event.ID).Str("Type", event.Type).Str("Ref", event.ProviderRef).Msg("Webhook event processed")
+	c.JSON(http.StatusOK, gin.H{"received": true})
+}
@@ -0,0 +1,84 @@
+package pricing
+
+import (
+	"eventy/config"
+	"eventy/pkg/models"
+	"strings"
+)
+
+// Quote is the server-side breakdown of what a booking costs, amounts in the smallest currency unit
+type Quote struct {
+	Price    int    `json:"price"`    // event or ticket type price of one seat
+	Seats    int    `json:"seats"`    // seats of the booking
+	Discount int    `json:"discount"` // taken off the price of the seats
+	Fee      int    `json:"fee"`      // card processing fee
+	Total    int    `json:"total"`    // amount charged
+	Currency string `json:"currency"`
+	Promo    string `json:"promo_code,omitempty"`
+}
+
+// Currency returns the currency of the event, or the platform currency
+func Currency(event *models.Event) string {
+	if event.Currency != "" {
+		return strings.ToLower(event.Currency)
+	}
+	return config.Configvar.Payment.Currency
+}
+
+// WalletAccepts reports whether amounts of the event may move through the wallet. Balances are
+// kept in the platform currency and never converted, only events priced in it qualify.
+func WalletAccepts(event *models.Event) bool {
+	return strings.EqualFold(Currency(event), config.Configvar.Payment.Currency)
+}
+
+// Wallet prices a booking of the given seats paid from the wallet balance, no fee applies.
+// The ticket type replaces the event price, it and the promo code, already checked
+// against the event and user, may be nil. The promo code applies once to the whole booking.
+func Wallet(event *models.Event, ticketType *models.TicketType, promo *models.PromoCode, seats int) Quote {
+	return build(event, ticketType, promo, seats)
+}
+
+// Card prices a booking paid by card, the configured fee is added to the discounted price
+func Card(event *models.Event, ticketType *models.TicketType, promo *models.PromoCode, seats int) Quote {
+	quote := build(event, ticketType, promo, seats)
+	if quote.Total > 0 {
+		quote.Fee = quote.Total*max(config.Configvar.Payment.CardFeePercent, 0)/100 + max(config.Configvar.Payment.CardFeeFixed, 0)
+		quote.Total += quote.Fee
+	}
+	return quote
+}
+
+// Discount returns what the promo code takes off a price, never more than the price
+func Discount(promo *models.PromoCode, price int) int {
+	if promo == nil || price <= 0 {
+		return 0
+	}
+
+	var discount int
+	switch promo.DiscountType {
+	case models.PromoDiscountPercent:
+		discount = price * min(max(promo.DiscountValue, 0), 100) / 100
+	case models.PromoDiscountFixed:
+		discount = max(promo.DiscountValue, 0)
+	}
+	return min(discount, price)
+}
+
+func build(event *models.Event, ticketType *models.TicketType, promo *models.PromoCode, seats int) Quote {
+	price := max(event.Price, 0)
+	if ticketType != nil {
+		price = max(ticketType.Price, 0)
+	}
+	seats = max(seats, 1)
+	quote := Quote{
+		Price:    price,
+		Seats:    seats,
+		Discount: Discount(promo, price*seats),
+		Currency: Currency(event),
+	}
+	if promo != nil {
+		quote.Promo = promo.Code
+	}
+	quote.Total = price*seats - quote.Discount
+	return quote
+}
@@ -0,0 +1,91 @@
+package scheduler
+
+import (
+	"context"
+	"eventy/config"
+	"eventy/pkg/db"
+	"eventy/pkg/notify"
+	"eventy/pkg/payment"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Job is a periodic background task
+type Job struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// jobs run in order on every tick
+var jobs = []Job{
+	{Name: "pending_bookings", Run: runPendingBookings},
+	{Name: "waitlist", Run: runWaitlist},
+	{Name: "event_decision", Run: runEventDecision},
+	{Name: "refunds", Run: payment.ProcessPendingRefunds},
+}
+
+// interval returns the tick period configured through SCHEDULER_INTERVAL (in seconds)
+func interval() time.Duration {
+	seconds := config.Configvar.Booking.SchedulerSec
+	if seconds <= 0 {
+		seconds = 60
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// Start runs the jobs in the background until the context is cancelled
+func Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(interval())
+		defer ticker.Stop()
+
+		log.Info().Msgf("Scheduler started, running every %s", interval())
+		for {
+			RunOnce(ctx)
+			select {
+			case <-ctx.Done():
+				log.Info().Msg("Scheduler stopped")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunOnce runs every job a single time, a failing job does not stop the others
+func RunOnce(ctx context.Context) {
+	for _, job := range jobs {
+		if err := job.Run(ctx); err != nil {
+			log.Err(err).Str("Job", job.Name).Msg("Scheduled job failed")
+		}
+	}
+}
+
+// runWaitlist expires unconfirmed offers and fills seats freed since the last run
+func runWaitlist(ctx context.Context) error {
+	expired, promotions, err := db.ExpireWaitlistOffers(ctx)
+	if err != nil {
+		return err
+	}
+	notify.WaitlistExpired(ctx, expired)
+	notify.WaitlistPromotions(ctx, promotions)
+
+	promotions, err = db.PromoteAllWaitlists(ctx)
+	notify.WaitlistPromotions(ctx, promotions)
+	return err
+}
+
+// runEventDecision confirms or cancels the events that reached their MinCapacity deadline
+func runEventDecision(ctx context.Context) error {
+	decisions, err := db.DecideEvents(ctx, time.Now())
+	notify.EventDecisions(ctx, decisions)
+	return err
+}
+
+// runPendingBookings releases the seats whose card payment did not succeed in time
+func runPendingBookings(ctx context.Context) error {
+	promotions, err := db.ExpirePendingBookings(ctx)
+	notify.WaitlistPromotions(ctx, promotions)
+	return err
+}
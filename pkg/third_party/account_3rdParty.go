@@ -0,0 +1,189 @@
+package third_party
+
+import (
+	"context"
+	"errors"
+	"eventy/config"
+	"eventy/functions"
+	"eventy/middleware"
+	"eventy/pkg/db"
+	"eventy/pkg/mailer"
+	"eventy/pkg/models"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/uptrace/bun"
+)
+
+// issueUserToken stores a new single-use token for the user and returns its plain value
+func issueUserToken(ctx context.Context, userID int, purpose string, lifetime time.Duration) (string, error) {
+	token, err := middleware.RandomToken(24)
+	if err != nil {
+		return "", err
+	}
+
+	err = db.AddUserToken(ctx, &models.UserToken{
+		TokenHash: middleware.HashToken(token),
+		UserID:    userID,
+		Purpose:   purpose,
+		ExpiresAt: time.Now().Add(lifetime),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// sendEmailVerification issues a verification token and mails it to the user
+func sendEmailVerification(ctx context.Context, user *models.User) error {
+	lifetime := time.Duration(config.Configvar.Mail.VerifyTkHours) * time.Hour
+	token, err := issueUserToken(ctx, user.UserID, models.TokenPurposeEmailVerification, lifetime)
+	if err != nil {
+		return err
+	}
+
+	return mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Eventy - verify your email",
+		Body: fmt.Sprintf("Hello %s,\n\nUse this code to verify your email address:\n\n%s\n\nThe code expires in %s.\n",
+			user.Name, token, lifetime),
+	})
+}
+
+// RequestPasswordReset mails a password reset token, the response never reveals whether the email exists
+func RequestPasswordReset(c *gin.Context) {
+	ctx := context.Background()
+	var req models.PasswordResetRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	response := gin.H{"message": "If the account exists, a reset code has been sent"}
+
+	user, err := db.GetUserByEmail(ctx, req.Email)
+	if err != nil {
+		log.Debug().Str("Email", req.Email).Msg("Password reset requested for unknown email")
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	lifetime := time.Duration(config.Configvar.Mail.ResetTkMin) * time.Minute
+	token, err := issueUserToken(ctx, user.UserID, models.TokenPurposePasswordReset, lifetime)
+	if err != nil {
+		log.Err(err).Int("UserID", user.UserID).Msg("Error issuing password reset token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request password reset"})
+		return
+	}
+
+	err = mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Eventy - password reset",
+		Body: fmt.Sprintf("Hello %s,\n\nUse this code to reset your password:\n\n%s\n\nThe code expires in %s. If you did not ask for a reset, ignore this email.\n",
+			user.Name, token, lifetime),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send reset email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ResetPassword sets a new password using a reset token and logs the user out everywhere
+func ResetPassword(c *gin.Context) {
+	ctx := context.Background()
+	var req models.PasswordResetConfirm
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	hash, err := functions.HashPassword(req.NewPassword)
+	if err != nil {
+		log.Warn().Err(err).Msg("Invalid new password")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid password"})
+		return
+	}
+
+	token, err := db.ConsumeUserToken(ctx, middleware.HashToken(req.Token), models.TokenPurposePasswordReset,
+		func(ctx context.Context, tx bun.Tx, token *models.UserToken) error {
+			return db.ResetUserPassword(ctx, tx, token.UserID, hash)
+		})
+	if err != nil {
+		respondUserTokenError(c, err)
+		return
+	}
+
+	log.Info().Int("UserID", token.UserID).Msg("Password reset")
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successful"})
+}
+
+// RequestEmailVerification sends a new verification code to the authenticated user
+func RequestEmailVerification(c *gin.Context) {
+	ctx := context.Background()
+
+	userID, ok := middleware.ResolveUserID(c, "")
+	if !ok {
+		return
+	}
+
+	user, err := db.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Warn().Err(err).Int("UserID", userID).Msg("Error retrieving User ID")
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.EmailVerified {
+		c.JSON(http.StatusOK, gin.H{"message": "Email already verified"})
+		return
+	}
+
+	if err := sendEmailVerification(ctx, user); err != nil {
+		log.Err(err).Int("UserID", userID).Msg("Error sending verification email")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification code sent"})
+}
+
+// VerifyEmail confirms the email address with a verification token
+func VerifyEmail(c *gin.Context) {
+	ctx := context.Background()
+	var req models.EmailVerificationConfirm
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	token, err := db.ConsumeUserToken(ctx, middleware.HashToken(req.Token), models.TokenPurposeEmailVerification,
+		func(ctx context.Context, tx bun.Tx, token *models.UserToken) error {
+			return db.MarkEmailVerified(ctx, tx, token.UserID)
+		})
+	if err != nil {
+		respondUserTokenError(c, err)
+		return
+	}
+
+	log.Info().Int("UserID", token.UserID).Msg("Email verified")
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+func respondUserTokenError(c *gin.Context, err error) {
+	if errors.Is(err, db.ErrUserTokenInvalid) || errors.Is(err, db.ErrUserTokenExpired) || errors.Is(err, db.ErrUserTokenUsed) {
+		log.Warn().Err(err).Msg("User token rejected")
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Err(err).Msg("Error consuming user token")
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred. Please try again later."})
+}
@@ -0,0 +1,149 @@
+package third_party
+
+import (
+	"context"
+	"errors"
+	"eventy/middleware"
+	"eventy/pkg/db"
+	"eventy/pkg/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// newSession issues an access token and a refresh token starting a new token family
+func newSession(ctx context.Context, user *models.User) (gin.H, error) {
+	refreshToken, hash, err := middleware.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	familyID, err := middleware.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.AddRefreshToken(ctx, &models.RefreshToken{
+		TokenHash: hash,
+		FamilyID:  familyID,
+		UserID:    user.UserID,
+		ExpiresAt: time.Now().Add(middleware.RefreshTokenLifetime()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sessionTokens(user, refreshToken)
+}
+
+func sessionTokens(user *models.User, refreshToken string) (gin.H, error) {
+	token, _, err := middleware.GenerateUserToken(user.UserID, user.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"token":         "Bearer " + token,
+		"expires_in":    int(middleware.AccessTokenLifetime().Seconds()),
+		"refresh_token": refreshToken,
+	}, nil
+}
+
+// Refresh rotates a refresh token and returns a new access token
+func Refresh(c *gin.Context) {
+	ctx := context.Background()
+	var req models.RefreshTokenRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	refreshToken, hash, err := middleware.GenerateRefreshToken()
+	if err != nil {
+		log.Err(err).Msg("Error generating refresh token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	next, err := db.RotateRefreshToken(ctx, middleware.HashToken(req.RefreshToken), &models.RefreshToken{
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(middleware.RefreshTokenLifetime()),
+	})
+	if err != nil {
+		if errors.Is(err, db.ErrRefreshTokenInvalid) || errors.Is(err, db.ErrRefreshTokenExpired) || errors.Is(err, db.ErrRefreshTokenReused) {
+			log.Warn().Err(err).Msg("Refresh rejected")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "code": -3})
+			return
+		}
+		log.Err(err).Msg("Error rotating refresh token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	user, err := db.GetUserByID(ctx, next.UserID)
+	if err != nil {
+		log.Warn().Err(err).Int("UserID", next.UserID).Msg("Refresh for unknown user")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found", "code": -3})
+		return
+	}
+
+	session, err := sessionTokens(user, refreshToken)
+	if err != nil {
+		log.Err(err).Int("UserID", user.UserID).Msg("Error generating token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// Logout revokes the session of the given refresh token
+func Logout(c *gin.Context) {
+	ctx := context.Background()
+	var req models.RefreshTokenRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	userID, err := db.RevokeRefreshTokenFamily(ctx, middleware.HashToken(req.RefreshToken))
+	if err != nil {
+		if errors.Is(err, db.ErrRefreshTokenInvalid) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "code": -3})
+			return
+		}
+		log.Err(err).Msg("Error revoking session")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
+		return
+	}
+
+	log.Info().Int("UserID", userID).Msg("User logged out")
+	c.JSON(http.StatusOK, gin.H{"message": "Logout successful"})
+}
+
+// LogoutAll revokes every session of the authenticated user
+func LogoutAll(c *gin.Context) {
+	ctx := context.Background()
+
+	userID, ok := middleware.CurrentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized, you need to connect first !", "code": -3})
+		return
+	}
+
+	revoked, err := db.RevokeAllUserRefreshTokens(ctx, userID)
+	if err != nil {
+		log.Err(err).Int("UserID", userID).Msg("Error revoking sessions")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
+		return
+	}
+
+	log.Info().Int("UserID", userID).Int64("Sessions", revoked).Msg("User logged out from all devices")
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Logged out from all devices",
+		"revoked_tokens": revoked,
+	})
+}
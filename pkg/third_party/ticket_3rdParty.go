@@ -0,0 +1,163 @@
+package third_party
+
+import (
+	"errors"
+	"eventy/middleware"
+	"eventy/pkg/db"
+	"eventy/pkg/models"
+	"eventy/pkg/ticket"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// QR image size bounds, in pixels
+const (
+	qrDefaultSize = 256
+	qrMaxSize     = 1024
+)
+
+// withQRPayloads signs the QR payload of the valid tickets, void tickets carry none
+func withQRPayloads(tickets []models.Ticket) []models.Ticket {
+	for i := range tickets {
+		if tickets[i].Status != models.TicketStatusValid {
+			continue
+		}
+		payload, err := ticket.Payload(&tickets[i])
+		if err != nil {
+			log.Err(err).Int("TicketID", tickets[i].TicketID).Msg("Error signing ticket payload")
+			continue
+		}
+		tickets[i].QRPayload = payload
+	}
+	return tickets
+}
+
+// GetMyTickets returns the tickets of the authenticated user with their QR payloads
+func GetMyTickets(c *gin.Context) {
+	userID, ok := middleware.ResolveUserID(c, c.Query("user_id"))
+	if !ok {
+		return
+	}
+
+	tickets, err := db.GetTicketsByUser(c.Request.Context(), userID)
+	if err != nil {
+		log.Err(err).Int("UserID", userID).Msg("Error getting tickets")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred. Please try again later."})
+		return
+	}
+
+	if len(tickets) == 0 {
+		c.JSON(http.StatusOK, []models.Ticket{})
+		return
+	}
+
+	c.JSON(http.StatusOK, withQRPayloads(tickets))
+}
+
+// GetTicketQR renders the QR code of a ticket of the authenticated user as PNG (default) or SVG
+func GetTicketQR(c *gin.Context) {
+	ticketID, err := strconv.Atoi(c.Param("ticket_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Ticket ID"})
+		return
+	}
+
+	userID, ok := middleware.ResolveUserID(c, "")
+	if !ok {
+		return
+	}
+
+	t, err := db.GetTicketByID(c.Request.Context(), ticketID)
+	if errors.Is(err, db.ErrTicketNotFound) || (err == nil && t.UserID != userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": db.ErrTicketNotFound.Error()})
+		return
+	}
+	if err != nil {
+		log.Err(err).Int("TicketID", ticketID).Msg("Error getting ticket")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred. Please try again later."})
+		return
+	}
+	if t.Status != models.TicketStatusValid {
+		c.JSON(http.StatusGone, gin.H{"error": "Ticket is no longer valid"})
+		return
+	}
+
+	payload, err := ticket.Payload(t)
+	if err != nil {
+		log.Err(err).Int("TicketID", ticketID).Msg("Error signing ticket payload")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Tickets are not available right now"})
+		return
+	}
+
+	switch c.DefaultQuery("format", ticket.FormatPNG) {
+	case ticket.FormatPNG:
+		size, err := strconv.Atoi(c.DefaultQuery("size", strconv.Itoa(qrDefaultSize)))
+		if err != nil || size <= 0 || size > qrMaxSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid size"})
+			return
+		}
+		image, err := ticket.PNG(payload, size)
+		if err != nil {
+			log.Err(err).Int("TicketID", ticketID).Msg("Error rendering QR code")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render the QR code"})
+			return
+		}
+		c.Data(http.StatusOK, "image/png", image)
+	case ticket.FormatSVG:
+		image, err := ticket.SVG(payload)
+		if err != nil {
+			log.Err(err).Int("TicketID", ticketID).Msg("Error rendering QR code")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render the QR code"})
+			return
+		}
+		c.Data(http.StatusOK, "image/svg+xml", image)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format, use png or svg"})
+	}
+}
+
+// ReassignTicket hands a ticket of the authenticated user to another attendee, the ticket
+// gets a new QR code and the previous one stops working
+func ReassignTicket(c *gin.Context) {
+	ticketID, err := strconv.Atoi(c.Param("ticket_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Ticket ID"})
+		return
+	}
+
+	userID, ok := middleware.ResolveUserID(c, "")
+	if !ok {
+		return
+	}
+
+	var req models.ReassignTicketRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	t, err := db.ReassignTicket(c.Request.Context(), db.ReassignTicketParams{
+		TicketID: ticketID,
+		OwnerID:  userID,
+		Name:     req.Name,
+		Email:    req.Email,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrTicketNotFound), errors.Is(err, db.ErrTicketForbidden):
+			c.JSON(http.StatusNotFound, gin.H{"error": db.ErrTicketNotFound.Error()})
+		case errors.Is(err, db.ErrTicketVoid), errors.Is(err, db.ErrAlreadyCheckedIn):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			log.Err(err).Int("TicketID", ticketID).Msg("Error reassigning ticket")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reassign the ticket"})
+		}
+		return
+	}
+
+	log.Info().Int("TicketID", t.TicketID).Int("UserID", userID).Msg("Ticket reassigned")
+	c.JSON(http.StatusOK, withQRPayloads([]models.Ticket{*t})[0])
+}
@@ -2,8 +2,13 @@ package third_party
 
 import (
 	"context"
+	"errors"
+	"eventy/functions"
+	"eventy/middleware"
 	"eventy/pkg/db"
 	"eventy/pkg/models"
+	"eventy/pkg/throttle"
+	"math"
 	"net/http"
 	"strconv"
 
@@ -22,27 +27,63 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	// Refuse attempts while the account or the client IP is throttled
+	throttler := throttle.Login()
+	accountKey := throttle.AccountKey("mobile", loginDetails.Email)
+	ipKey := throttle.IPKey("mobile", c.ClientIP())
+	if allowed, wait := throttler.Allow(accountKey, ipKey); !allowed {
+		retryAfter := int(math.Ceil(wait.Seconds()))
+		log.Warn().Str("Email", loginDetails.Email).Str("IP", c.ClientIP()).Dur("RetryAfter", wait).Msg("Login throttled")
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Too many failed login attempts, try again later",
+			"retry_after": retryAfter,
+		})
+		return
+	}
+
 	// Check if user exists
 	user, err := db.GetUserByEmail(ctx, loginDetails.Email)
 	if err != nil {
+		throttler.Failure(accountKey, ipKey)
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
-	// Validate password (later, you should hash passwords)
-	if user.Password != loginDetails.Password {
+	// Validate password, legacy plaintext rows are accepted once and rehashed
+	match, needsUpgrade := functions.VerifyStoredPassword(user.Password, loginDetails.Password)
+	if !match {
+		throttler.Failure(accountKey, ipKey)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
+	throttler.Success(accountKey)
+
+	if needsUpgrade {
+		hash, err := functions.HashPassword(loginDetails.Password)
+		if err == nil {
+			err = db.SetUserPasswordHash(ctx, user.UserID, hash)
+		}
+		if err != nil {
+			log.Err(err).Int("UserID", user.UserID).Msg("Error upgrading plaintext password")
+		} else {
+			log.Info().Int("UserID", user.UserID).Msg("Plaintext password upgraded to hash")
+		}
+	}
+
+	session, err := newSession(ctx, user)
+	if err != nil {
+		log.Err(err).Str("Email", user.Email).Msg("Error generating token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
 
 	// Return user details
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Login successful",
-		"user_id": user.UserID,
-		"email":   user.Email,
-		"name":    user.Name,
-		"token":   "Bearer token",
-	})
+	session["message"] = "Login successful"
+	session["user_id"] = user.UserID
+	session["email"] = user.Email
+	session["name"] = user.Name
+	c.JSON(http.StatusOK, session)
 }
 
 // Register new user
@@ -68,6 +109,12 @@ func Register(c *gin.Context) {
 			return
 		}
 
+		// The account stays usable even if the verification mail fails, it can be requested again
+		if err := sendEmailVerification(ctx, &registerDetail); err != nil {
+			log.Err(err).Str("Email", registerDetail.Email).Msg("Error sending verification email")
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Register successful"})
 		return
 	}
 	if user.Email == registerDetail.Email {
@@ -82,16 +129,9 @@ func Register(c *gin.Context) {
 // Update user profile
 func UpdateProfile(c *gin.Context) {
 	ctx := context.Background()
-	idStr := c.Query("user_id")
 
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		log.Warn().Err(err).Str("UserID", idStr).Msg("Invalid User ID")
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"message": "Invalid User ID",
-			"code":    -400,
-		})
+	id, ok := middleware.ResolveUserID(c, c.Query("user_id"))
+	if !ok {
 		return
 	}
 
@@ -106,7 +146,22 @@ func UpdateProfile(c *gin.Context) {
 		return
 	}
 
-	rowsAffected, err := db.UpdateUser(ctx, id, &updates)
+	// A profile update must not touch the wallet or guest status, a new email must be verified again
+	updates.UserID = 0
+	updates.Balance = 0
+	updates.Is_guest = false
+	updates.EmailVerified = false
+
+	rowsAffected, emailChanged, err := db.UpdateUser(ctx, id, &updates)
+	if errors.Is(err, db.ErrEmailTaken) {
+		log.Warn().Int("UserID", id).Msg("Email already used by another user")
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "Email already used by another user",
+			"code":    -409,
+		})
+		return
+	}
 	if err != nil {
 		log.Err(err).Msg("Error updating user")
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -127,6 +182,17 @@ func UpdateProfile(c *gin.Context) {
 		return
 	}
 
+	// The profile is saved even if the mail fails, the code can be requested again
+	if emailChanged {
+		user, err := db.GetUserByID(ctx, id)
+		if err == nil {
+			err = sendEmailVerification(ctx, user)
+		}
+		if err != nil {
+			log.Err(err).Int("UserID", id).Msg("Error sending verification email")
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "User updated successfully",
@@ -137,20 +203,17 @@ func UpdateProfile(c *gin.Context) {
 // Get user profile by ID
 func GetUserProfile(c *gin.Context) {
 	ctx := context.Background()
-	idStr := c.Query("user_id")
-	user := []models.User{}
 
-	id, _ := strconv.Atoi(idStr)
-	if idStr != "" {
-		log.Debug().Int("UserID", id).Msg("Get User by ID API mobile request")
-		user, err := db.GetUserByID(ctx, id)
-		if err != nil {
-			log.Warn().Err(err).Str("UserID", idStr).Msg("Error retrieving User ID")
-			c.JSON(http.StatusOK, []models.User{})
-			return
-		}
+	id, ok := middleware.ResolveUserID(c, c.Query("user_id"))
+	if !ok {
+		return
+	}
 
-		c.JSON(http.StatusOK, user)
+	log.Debug().Int("UserID", id).Msg("Get User by ID API mobile request")
+	user, err := db.GetUserByID(ctx, id)
+	if err != nil {
+		log.Warn().Err(err).Int("UserID", id).Msg("Error retrieving User ID")
+		c.JSON(http.StatusOK, []models.User{})
 		return
 	}
 
@@ -1,9 +1,14 @@
 package third_party
 
 import (
+	"errors"
+	"eventy/middleware"
 	"eventy/pkg/db"
 	"eventy/pkg/models"
+	"eventy/pkg/notify"
+	"eventy/pkg/payment"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
@@ -21,29 +26,140 @@ func BookEventHandler(c *gin.Context) {
 
 	log.Debug().Interface("BookEventHandler API request ", &req).Send()
 
-	// Call the booking function
-	rowsAffected, err := db.BookEvent(c.Request.Context(), req.EventID, req.UserID)
+	userID, ok := middleware.ResolveUserID(c, strconv.Itoa(req.UserID))
+	if !ok {
+		return
+	}
+	req.UserID = userID
+
+	// Book the seats and debit the wallet in one transaction
+	booking, err := db.BookEvent(c.Request.Context(), req.EventID, req.UserID, db.BookingOptions{
+		TicketTypeID: req.TicketTypeID,
+		PromoCode:    req.PromoCode,
+		Seats:        req.Seats,
+		Attendees:    req.Attendees,
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		switch {
+		case errors.Is(err, db.ErrEventNotFound), errors.Is(err, db.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, db.ErrEventFull) && max(req.Seats, len(req.Attendees)) > 1:
+			// The waitlist holds single seats, a group that does not fit is refused
+			c.JSON(http.StatusConflict, gin.H{"error": "Not enough seats left for the group"})
+		case errors.Is(err, db.ErrEventFull):
+			joinWaitlist(c, req.EventID, req.UserID)
+		case errors.Is(err, db.ErrAlreadyBooked), errors.Is(err, db.ErrEventCancelled):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, db.ErrInsufficientBalance):
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+		case errors.Is(err, db.ErrWalletCurrency):
+			c.JSON(http.StatusConflict, gin.H{"error": "This event can only be paid by card"})
+		case errors.Is(err, db.ErrPromoNotFound), errors.Is(err, db.ErrPromoNotApplicable),
+			errors.Is(err, db.ErrTicketTypeNotFound), errors.Is(err, db.ErrTicketTypeRequired),
+			errors.Is(err, db.ErrSeatLimit), errors.Is(err, db.ErrTooManyAttendees):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, db.ErrPromoExhausted), errors.Is(err, db.ErrPromoUserLimit),
+			errors.Is(err, db.ErrTicketTypeNotOnSale), errors.Is(err, db.ErrTicketTypeSoldOut):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
-	event, err := db.GetEventByID(c.Request.Context(), req.EventID)
+	tickets, err := db.GetTicketsByBooking(c.Request.Context(), booking.BookingID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		log.Err(err).Int("BookingID", booking.BookingID).Msg("Error getting tickets")
+	}
+
+	// Return success response
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Event booked successfully",
+		"booking_id":     booking.BookingID,
+		"seats":          booking.Seats,
+		"price_paid":     booking.PricePaid,
+		"ticket_type_id": booking.TicketTypeID,
+		"discount":       booking.Discount,
+		"promo_code":     booking.PromoCode,
+		"tickets":        withQRPayloads(tickets),
+		"rows_affected":  1,
+	})
+}
+
+// GetMyBookings returns every booking of the authenticated user
+func GetMyBookings(c *gin.Context) {
+	userID, ok := middleware.ResolveUserID(c, c.Query("user_id"))
+	if !ok {
 		return
 	}
 
-	// increment the price from user balance
-	_, err = db.TopDownBalance(c.Request.Context(), req.UserID, event.Price)
+	bookings, err := db.GetBookingsByUser(c.Request.Context(), userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		log.Err(err).Int("UserID", userID).Msg("Error getting bookings")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred. Please try again later."})
 		return
 	}
 
-	// Return success response
+	if len(bookings) == 0 {
+		c.JSON(http.StatusOK, []models.Booking{})
+		return
+	}
+
+	c.JSON(http.StatusOK, bookings)
+}
+
+// CancelBookingHandler cancels a booking of the authenticated user and refunds it per the event policy
+func CancelBookingHandler(c *gin.Context) {
+	idStr := c.Param("booking_id")
+	bookingID, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Booking ID"})
+		return
+	}
+
+	userID, ok := middleware.ResolveUserID(c, "")
+	if !ok {
+		return
+	}
+
+	var req models.CancelBookingRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+	}
+
+	result, err := db.CancelBooking(c.Request.Context(), db.CancelBookingParams{
+		BookingID: bookingID,
+		OwnerID:   userID,
+		Actor:     middleware.Actor(c),
+		Reason:    req.Reason,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrBookingNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, db.ErrBookingForbidden):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, db.ErrBookingNotActive), errors.Is(err, db.ErrWalletCurrency):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			log.Err(err).Int("BookingID", bookingID).Msg("Error cancelling booking")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel booking"})
+		}
+		return
+	}
+
+	payment.ProcessRefunds(c.Request.Context(), result.Refund)
+	notify.WaitlistPromotions(c.Request.Context(), result.Promotions)
+
 	c.JSON(http.StatusOK, gin.H{
-		"message":       "Event booked successfully",
-		"rows_affected": rowsAffected,
+		"message":        "Booking cancelled successfully",
+		"booking_id":     result.Booking.BookingID,
+		"refund_amount":  result.Refund.Amount,
+		"refund_percent": result.Refund.Percent,
+		"refund_method":  result.Refund.Method,
+		"refund_status":  result.Refund.Status,
 	})
 }
@@ -0,0 +1,81 @@
+package third_party
+
+import (
+	"errors"
+	"eventy/middleware"
+	"eventy/pkg/db"
+	"eventy/pkg/models"
+	"eventy/pkg/notify"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// joinWaitlist queues the user on a full event and answers the booking request with the position
+func joinWaitlist(c *gin.Context, eventID, userID int) {
+	entry, err := db.JoinWaitlist(c.Request.Context(), eventID, userID)
+	if err != nil {
+		log.Err(err).Int("EventID", eventID).Int("UserID", userID).Msg("Error joining waitlist")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join the waitlist"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":  "Event is full, you have been added to the waitlist",
+		"waitlist": entry,
+		"position": entry.Position,
+	})
+}
+
+// GetMyWaitlist returns the open waitlist entries of the authenticated user
+func GetMyWaitlist(c *gin.Context) {
+	userID, ok := middleware.ResolveUserID(c, c.Query("user_id"))
+	if !ok {
+		return
+	}
+
+	entries, err := db.GetWaitlistByUser(c.Request.Context(), userID)
+	if err != nil {
+		log.Err(err).Int("UserID", userID).Msg("Error getting waitlist")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred. Please try again later."})
+		return
+	}
+
+	if len(entries) == 0 {
+		c.JSON(http.StatusOK, []models.WaitlistEntry{})
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// LeaveWaitlist removes the authenticated user from the waitlist of an event
+func LeaveWaitlist(c *gin.Context) {
+	eventID, err := strconv.Atoi(c.Param("event_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Event ID"})
+		return
+	}
+
+	userID, ok := middleware.ResolveUserID(c, "")
+	if !ok {
+		return
+	}
+
+	promotions, err := db.LeaveWaitlist(c.Request.Context(), eventID, userID)
+	if err != nil {
+		if errors.Is(err, db.ErrNotOnWaitlist) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		log.Err(err).Int("EventID", eventID).Int("UserID", userID).Msg("Error leaving waitlist")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to leave the waitlist"})
+		return
+	}
+
+	notify.WaitlistPromotions(c.Request.Context(), promotions)
+
+	c.JSON(http.StatusOK, gin.H{"message": "You left the waitlist"})
+}
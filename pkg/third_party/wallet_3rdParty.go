@@ -0,0 +1,53 @@
+package third_party
+
+import (
+	"eventy/middleware"
+	"eventy/pkg/db"
+	"eventy/pkg/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// GetWalletTransactions returns the balance and the wallet ledger of the authenticated user, newest first
+func GetWalletTransactions(c *gin.Context) {
+	userID, ok := middleware.ResolveUserID(c, c.Query("user_id"))
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	user, err := db.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		log.Err(err).Int("UserID", userID).Msg("Error getting user")
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	entries, err := db.GetWalletTransactions(c.Request.Context(), userID, limit, offset)
+	if err != nil {
+		log.Err(err).Int("UserID", userID).Msg("Error getting wallet transactions")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred. Please try again later."})
+		return
+	}
+	if entries == nil {
+		entries = []models.WalletTransaction{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"balance":      user.Balance,
+		"transactions": entries,
+		"limit":        limit,
+		"offset":       offset,
+	})
+}
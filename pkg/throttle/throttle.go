@@ -0,0 +1,200 @@
+package throttle
+
+import (
+	"eventy/config"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Settings of a Throttler, see the LOGIN_* entries of the config
+type Settings struct {
+	FreeAttempts    int           // failures allowed before any delay
+	BaseDelay       time.Duration // first backoff delay, doubled on each further failure
+	MaxDelay        time.Duration // upper bound of the backoff delay
+	LockoutAttempts int           // failures that lock the key
+	LockoutDuration time.Duration // how long a locked key stays locked
+	Window          time.Duration // failures older than this are forgotten
+}
+
+// Entry is the failure state of one key (an account or a client IP)
+type Entry struct {
+	Key          string    `json:"key"`
+	Failures     int       `json:"failures"`
+	LastFailure  time.Time `json:"last_failure"`
+	BlockedUntil time.Time `json:"blocked_until"`
+	Locked       bool      `json:"locked"`
+}
+
+// Throttler counts failed logins per key and applies exponential backoff then a temporary lockout.
+// State is kept in memory, so limits apply per running instance.
+type Throttler struct {
+	mu       sync.Mutex
+	settings Settings
+	entries  map[string]*Entry
+	now      func() time.Time
+}
+
+func New(settings Settings) *Throttler {
+	return &Throttler{
+		settings: settings,
+		entries:  make(map[string]*Entry),
+		now:      time.Now,
+	}
+}
+
+var (
+	loginOnce sync.Once
+	login     *Throttler
+)
+
+// Login returns the throttler shared by the mobile and back-office login endpoints
+func Login() *Throttler {
+	loginOnce.Do(func() {
+		cfg := config.Configvar.Throttle
+		login = New(Settings{
+			FreeAttempts:    cfg.FreeAttempts,
+			BaseDelay:       time.Duration(cfg.BaseDelaySec) * time.Second,
+			MaxDelay:        time.Duration(cfg.MaxDelaySec) * time.Second,
+			LockoutAttempts: cfg.LockoutAttempts,
+			LockoutDuration: time.Duration(cfg.LockoutMinutes) * time.Minute,
+			Window:          time.Duration(cfg.WindowMinutes) * time.Minute,
+		})
+	})
+	return login
+}
+
+// AccountKey builds the key of an account for a login scope ("mobile", "backoffice")
+func AccountKey(scope, account string) string {
+	return "account:" + scope + ":" + strings.ToLower(strings.TrimSpace(account))
+}
+
+// IPKey builds the key of a client IP for a login scope
+func IPKey(scope, ip string) string {
+	return "ip:" + scope + ":" + ip
+}
+
+// Allow reports whether an attempt may be made for every key, and otherwise how long to wait
+func (t *Throttler) Allow(keys ...string) (bool, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	var wait time.Duration
+	for _, key := range keys {
+		entry := t.current(key, now)
+		if entry == nil {
+			continue
+		}
+		if remaining := entry.BlockedUntil.Sub(now); remaining > wait {
+			wait = remaining
+		}
+	}
+	return wait <= 0, wait
+}
+
+// Failure records a failed attempt for every key
+func (t *Throttler) Failure(keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	for _, key := range keys {
+		entry := t.current(key, now)
+		if entry == nil {
+			entry = &Entry{Key: key}
+			t.entries[key] = entry
+		}
+
+		entry.Failures++
+		entry.LastFailure = now
+
+		switch {
+		case t.settings.LockoutAttempts > 0 && entry.Failures >= t.settings.LockoutAttempts:
+			entry.Locked = true
+			entry.BlockedUntil = now.Add(t.settings.LockoutDuration)
+		case entry.Failures > t.settings.FreeAttempts:
+			entry.BlockedUntil = now.Add(t.backoff(entry.Failures - t.settings.FreeAttempts))
+		}
+	}
+	t.prune(now)
+}
+
+// Success clears the failures of the given keys
+func (t *Throttler) Success(keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, key := range keys {
+		delete(t.entries, key)
+	}
+}
+
+// Locked lists the keys currently locked out
+func (t *Throttler) Locked() []Entry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	locked := []Entry{}
+	for key := range t.entries {
+		entry := t.current(key, now)
+		if entry != nil && entry.Locked {
+			locked = append(locked, *entry)
+		}
+	}
+
+	sort.Slice(locked, func(i, j int) bool { return locked[i].Key < locked[j].Key })
+	return locked
+}
+
+// Unlock clears a key, it returns false when the key had no recorded failures
+func (t *Throttler) Unlock(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, exists := t.entries[key]
+	delete(t.entries, key)
+	return exists
+}
+
+func (t *Throttler) backoff(extraFailures int) time.Duration {
+	delay := t.settings.BaseDelay
+	for i := 1; i < extraFailures && delay < t.settings.MaxDelay; i++ {
+		delay *= 2
+	}
+	if t.settings.MaxDelay > 0 && delay > t.settings.MaxDelay {
+		delay = t.settings.MaxDelay
+	}
+	return delay
+}
+
+// current returns the live entry of key, dropping it once its lockout and window are over
+func (t *Throttler) current(key string, now time.Time) *Entry {
+	entry, exists := t.entries[key]
+	if !exists {
+		return nil
+	}
+	if t.expired(entry, now) {
+		delete(t.entries, key)
+		return nil
+	}
+	return entry
+}
+
+func (t *Throttler) expired(entry *Entry, now time.Time) bool {
+	if !now.After(entry.BlockedUntil) {
+		return false
+	}
+	// A served lockout starts over from a clean slate
+	return entry.Locked || now.Sub(entry.LastFailure) > t.settings.Window
+}
+
+func (t *Throttler) prune(now time.Time) {
+	for key, entry := range t.entries {
+		if t.expired(entry, now) {
+			delete(t.entries, key)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package ticket
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"eventy/pkg/models"
+	"fmt"
+	"strings"
+)
+
+// manifestVersion prefixes the signed manifest message
+const manifestVersion = "M1"
+
+// ManifestMessage is what the manifest signature covers:
+// "M1.<event_id>.<generated_at unix>.<sha256 of the codes>.<sha256 of the checked-in codes>",
+// codes joined by commas in the order of the manifest
+func ManifestMessage(m *models.CheckInManifest) string {
+	codes := sha256.Sum256([]byte(strings.Join(m.Codes, ",")))
+	checkedIn := sha256.Sum256([]byte(strings.Join(m.CheckedIn, ",")))
+	return fmt.Sprintf("%s.%d.%d.%s.%s", manifestVersion, m.EventID, m.GeneratedAt.Unix(),
+		hex.EncodeToString(codes[:]), hex.EncodeToString(checkedIn[:]))
+}
+
+// SignManifest sets the signature of a manifest, scanners verify it with the ticket signing key
+func SignManifest(m *models.CheckInManifest) error {
+	signature, err := Sign(ManifestMessage(m))
+	if err != nil {
+		return err
+	}
+	m.Signature = signature
+	return nil
+}
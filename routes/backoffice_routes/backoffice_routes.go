@@ -1,15 +1,22 @@
 package backoffice_routes
 
 import (
+	"eventy/middleware"
 	"eventy/pkg/backoffice"
 
 	"github.com/gin-gonic/gin"
 )
 
+// BackOfficeToken registers the public login route issuing back-office tokens
+func BackOfficeToken(router *gin.Engine) {
+	router.POST("/backoffice/login", backoffice.Login)
+}
+
 // SetupRoutes configures all the routes for the backoffice package
 func Backoffice_Routes(router *gin.Engine) {
 	// User routes
 	backoffice_grp := router.Group("/backoffice")
+	backoffice_grp.Use(middleware.TokenMiddlewareBackOffice(), middleware.RoleMiddlewareBackOffice())
 	{
 
 		// User routes
@@ -26,6 +33,7 @@ func Backoffice_Routes(router *gin.Engine) {
 
 		// Event routes
 		backoffice_grp.GET("/get_events", backoffice.GetEvents)
+		backoffice_grp.GET("/get_events_at_risk", backoffice.GetEventsAtRisk)
 		backoffice_grp.POST("/add_event", backoffice.AddEvent)
 		backoffice_grp.PUT("/update_event/:event_id", backoffice.UpdateEvent)
 		backoffice_grp.DELETE("/delete_event/:event_id", backoffice.DeleteEvent)
@@ -35,6 +43,46 @@ func Backoffice_Routes(router *gin.Engine) {
 		backoffice_grp.POST("/accept_guest/:user_id", backoffice.AcceptGuest)
 		backoffice_grp.POST("/decline_guest/:user_id", backoffice.DeclineGuest)
 
+		// Booking routes
+		backoffice_grp.GET("/get_bookings", backoffice.GetBookings)
+		backoffice_grp.POST("/cancel_booking/:booking_id", backoffice.CancelBooking)
+		backoffice_grp.GET("/get_refunds", backoffice.GetRefunds)
+		backoffice_grp.POST("/refund_booking/:booking_id", backoffice.RefundBooking)
+		backoffice_grp.POST("/retry_refund/:refund_id", backoffice.RetryRefund)
+		backoffice_grp.GET("/get_waitlist", backoffice.GetWaitlist)
+
+		// Ticket type routes
+		backoffice_grp.GET("/get_ticket_types", backoffice.GetTicketTypes)
+		backoffice_grp.POST("/add_ticket_type", backoffice.AddTicketType)
+		backoffice_grp.PUT("/update_ticket_type/:ticket_type_id", backoffice.UpdateTicketType)
+		backoffice_grp.DELETE("/delete_ticket_type/:ticket_type_id", backoffice.DeleteTicketType)
+
+		// Promo code routes
+		backoffice_grp.GET("/get_promo_codes", backoffice.GetPromoCodes)
+		backoffice_grp.POST("/add_promo_code", backoffice.AddPromoCode)
+		backoffice_grp.PUT("/update_promo_code/:promo_id", backoffice.UpdatePromoCode)
+		backoffice_grp.DELETE("/delete_promo_code/:promo_id", backoffice.DeletePromoCode)
+
+		// Check-in routes
+		backoffice_grp.POST("/check_in", backoffice.CheckInTicket)
+		backoffice_grp.GET("/get_check_in_stats", backoffice.GetCheckInStats)
+		backoffice_grp.GET("/get_check_in_manifest", backoffice.GetCheckInManifest)
+		backoffice_grp.POST("/sync_check_ins", backoffice.SyncCheckIns)
+
+		// Wallet routes
+		backoffice_grp.PUT("/topup_balance/:user_id", backoffice.TopupUserBalance)
+		backoffice_grp.GET("/get_wallet_transactions", backoffice.GetWalletTransactions)
+
+		// Operator routes (super-admin only)
+		backoffice_grp.GET("/get_operators", backoffice.GetOperators)
+		backoffice_grp.POST("/add_operator", backoffice.AddOperator)
+		backoffice_grp.PUT("/update_operator/:operator_id", backoffice.UpdateOperator)
+		backoffice_grp.DELETE("/delete_operator/:operator_id", backoffice.DeleteOperator)
+
+		// Login throttle routes (super-admin only)
+		backoffice_grp.GET("/get_locked_accounts", backoffice.GetLockedAccounts)
+		backoffice_grp.POST("/unlock_account", backoffice.UnlockAccount)
+
 	}
 
 }
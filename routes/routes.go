@@ -27,14 +27,9 @@ func SetupRouter() *gin.Engine {
 
 	log.Debug().Msg("--------------------------  START ROUTING  ----------------------")
 
-	backoffice_routes.Backoffice_Routes(router)
-	third_party_routes.ThirdParty_Routes(router)
-
-	//authorizedBackOffice := router.Group("/")
-	//authorizedBackOffice.Use(middleware.TokenMiddlewareBackOffice())
-
-	//backoffice_routes.BackOfficeToken(router)                // Token Generator FOR BACKOFFICE ------------------
-	//backoffice_routes.BackOfficeRouter(authorizedBackOffice) // BACKOFFICE ROUTES --------------------------------
+	backoffice_routes.BackOfficeToken(router)    // Token Generator FOR BACKOFFICE ------------------
+	backoffice_routes.Backoffice_Routes(router)  // BACKOFFICE ROUTES (token required) ---------------
+	third_party_routes.ThirdParty_Routes(router) // MOBILE ROUTES ------------------------------------
 
 	//backoffice_routes.ExportBackoffice(authorizedBackOffice) // BACKOFFICE EXPORT ROUTES ---------------------------
 
@@ -1,8 +1,9 @@
 package third_party_routes
 
 import (
+	"eventy/middleware"
 	"eventy/pkg/backoffice"
-	"eventy/pkg/stripe"
+	"eventy/pkg/payment"
 	"eventy/pkg/third_party"
 
 	"github.com/gin-gonic/gin"
@@ -18,11 +19,37 @@ func ThirdParty_Routes(router *gin.Engine) {
 		mobile_grp.GET("/get_categories", backoffice.GetCategories)
 		mobile_grp.POST("/login", third_party.Login)
 		mobile_grp.POST("/register", third_party.Register)
-		mobile_grp.PUT("/update_profile", third_party.UpdateProfile)
-		mobile_grp.GET("/get_profile", third_party.GetUserProfile)
-		mobile_grp.POST("/book-event", third_party.BookEventHandler)
-		mobile_grp.PUT("/topup_balance", backoffice.TopupBalance)
-		mobile_grp.POST("/pay", stripe.PayEvent)
+		mobile_grp.POST("/refresh", third_party.Refresh)
+		mobile_grp.POST("/logout", third_party.Logout)
+		mobile_grp.POST("/request_password_reset", third_party.RequestPasswordReset)
+		mobile_grp.POST("/reset_password", third_party.ResetPassword)
+		mobile_grp.POST("/verify_email", third_party.VerifyEmail)
+
+	}
+
+	// Payment provider events, authenticated by their signature
+	router.POST("/stripe/webhook", payment.Webhook)
+	router.POST("/payment/webhook", payment.Webhook)
+
+	// Routes requiring a mobile user token
+	authorized_grp := router.Group("/mobile")
+	authorized_grp.Use(middleware.TokenMiddleware3rdParty())
+	{
+		authorized_grp.PUT("/update_profile", third_party.UpdateProfile)
+		authorized_grp.GET("/get_profile", third_party.GetUserProfile)
+		authorized_grp.POST("/book-event", third_party.BookEventHandler)
+		authorized_grp.GET("/get_bookings", third_party.GetMyBookings)
+		authorized_grp.POST("/cancel_booking/:booking_id", third_party.CancelBookingHandler)
+		authorized_grp.GET("/get_tickets", third_party.GetMyTickets)
+		authorized_grp.GET("/ticket_qr/:ticket_id", third_party.GetTicketQR)
+		authorized_grp.PUT("/reassign_ticket/:ticket_id", third_party.ReassignTicket)
+		authorized_grp.GET("/get_waitlist", third_party.GetMyWaitlist)
+		authorized_grp.POST("/leave_waitlist/:event_id", third_party.LeaveWaitlist)
+		authorized_grp.POST("/topup", payment.TopupWallet)
+		authorized_grp.GET("/get_wallet_transactions", third_party.GetWalletTransactions)
+		authorized_grp.POST("/pay", payment.PayEvent)
+		authorized_grp.POST("/logout_all", third_party.LogoutAll)
+		authorized_grp.POST("/request_email_verification", third_party.RequestEmailVerification)
 
 	}
 